@@ -1,18 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"stackexchange-data-analysis/internal/anonymize"
 	"stackexchange-data-analysis/internal/config"
 	"stackexchange-data-analysis/internal/database"
+	"stackexchange-data-analysis/internal/explain"
+	"stackexchange-data-analysis/internal/exporter"
 	"stackexchange-data-analysis/internal/importer"
 	"stackexchange-data-analysis/internal/queries"
 )
@@ -21,12 +27,39 @@ func main() {
 	logger := setupLogger()
 	defer logger.Sync()
 
-	mode := flag.String("mode", "", "Режим работы: import, queries, all")
+	mode := flag.String("mode", "", "Режим работы: import, delta, anonymize, export, queries, analysis, bench, index-lab, all, migrate")
 	configPath := flag.String("config", "", "Путь к файлу конфигурации")
+	sites := flag.String("sites", "", "Список сайтов для импорта через запятую; по умолчанию все сайты из директории данных")
+	resume := flag.Bool("resume", false, "Продолжить прерванный импорт: пропустить завершённые файлы и уже загруженные строки")
+	reset := flag.Bool("reset", false, "Удалить все таблицы и данные перед импортом")
+	dumpDate := flag.String("dump-date", "", "Дата дампа (ГГГГ-ММ-ДД) для режима delta; по умолчанию текущая дата")
+	snapshot := flag.Bool("snapshot", false, "Сохранить версии строк как снимок дампа на дату --dump-date (вместе с --delta)")
+	anonymizeData := flag.Bool("anonymize", false, "Анонимизировать персональные данные при импорте")
+	anonymizePolicy := flag.String("anonymize-policy", "", "Файл политики анонимизации (yaml); по умолчанию встроенная политика")
+	exportDir := flag.String("export-dir", "./export", "Директория для выгрузки в режиме export")
+	exportFormat := flag.String("format", "xml", "Формат выгрузки в режиме export: xml или parquet")
+	partition := flag.String("partition", "none", "Разбиение parquet файлов: none, site или site-year")
+	rowGroupRows := flag.Int64("row-group-rows", 1000000, "Максимальное число строк в группе строк parquet")
+	tags := flag.String("tags", "", "Выборочный импорт: теги постов через запятую")
+	from := flag.String("from", "", "Выборочный импорт: посты, созданные не раньше даты (ГГГГ-ММ-ДД)")
+	to := flag.String("to", "", "Выборочный импорт: посты, созданные раньше даты (ГГГГ-ММ-ДД)")
+	postTypes := flag.String("post-types", "", "Выборочный импорт: типы постов через запятую; по умолчанию 1 (вопросы)")
+	site := flag.String("site", "", "Сайт для анализа (например, dba.stackexchange.com); по умолчанию все сайты")
+	asOf := flag.String("as-of", "", "Выполнить запросы на снимке: дата дампа (ГГГГ-ММ-ДД) или dump_id")
+	params := queries.NewParams()
+	flag.Var(params, "param", "Параметр запросов имя=значение или запрос.имя=значение; можно указать несколько раз")
+	paramsFile := flag.String("params", "", "Файл запуска (yaml) со значениями параметров запросов")
+	resultFormat := flag.String("result-format", "", "Форматы результатов запросов через запятую: json, ndjson, csv, markdown, html; по умолчанию из заголовков запросов или json")
+	baselineDir := flag.String("baseline-dir", "", "Директория базовых планов запросов; если задана, планы сравниваются с базовыми и регрессия завершает работу с ошибкой")
+	updateBaseline := flag.Bool("update-baseline", false, "Сохранить текущие планы запросов как базовые")
+	rowsFactor := flag.Float64("rows-factor", explain.DefaultThresholds().RowsFactor, "Допустимое расхождение оценки и фактического числа строк узла плана, раз")
+	timeFactor := flag.Float64("time-factor", explain.DefaultThresholds().TimeFactor, "Допустимый рост времени выполнения запроса относительно базового плана, раз")
 	flag.Parse()
 
-	if *mode == "" && flag.NArg() > 0 {
-		*mode = flag.Arg(0)
+	args := flag.Args()
+	if *mode == "" && len(args) > 0 {
+		*mode = args[0]
+		args = args[1:]
 	}
 
 	var cfg *config.Config
@@ -36,16 +69,48 @@ func main() {
 		logger.Info("использую указанный конфигурационный файл", zap.String("path", *configPath))
 	}
 
+	if *dumpDate != "" {
+		viper.Set("dump_date", *dumpDate)
+	}
+	if *tags != "" {
+		viper.Set("subset.tags", splitList(*tags))
+	}
+	if *from != "" {
+		viper.Set("subset.from", *from)
+	}
+	if *to != "" {
+		viper.Set("subset.to", *to)
+	}
+	if *postTypes != "" {
+		viper.Set("subset.post_types", splitList(*postTypes))
+	}
+
 	cfg, err = config.Load()
 	if err != nil {
 		logger.Fatal("ошибка загрузки конфигурации", zap.Error(err))
 	}
 
-	db, err := connectToDatabase(cfg, logger)
+	if *sites != "" {
+		cfg.Sites = splitList(*sites)
+	}
+	if *resume {
+		cfg.Resume = true
+	}
+	if *snapshot {
+		cfg.Snapshot = true
+	}
+	if *anonymizeData {
+		cfg.Anonymize = true
+	}
+	if *anonymizePolicy != "" {
+		cfg.AnonymizePolicy = *anonymizePolicy
+	}
+
+	store, err := connectToDatabase(cfg, logger)
 	if err != nil {
 		logger.Fatal("ошибка подключения к базе данных", zap.Error(err))
 	}
-	defer db.Close()
+	defer store.Close()
 
 	scriptsDir := "../scripts"
 	if _, err := os.Stat(scriptsDir); os.IsNotExist(err) {
@@ -55,22 +120,63 @@ func main() {
 		}
 	}
 
-	schemaPath := filepath.Join(scriptsDir, "create_schema.sql")
-	indexesPath := filepath.Join(scriptsDir, "indexes.sql")
 	queriesDir := scriptsDir
 	resultsDir := "./results"
+	if *asOf != "" {
+		resultsDir = filepath.Join(resultsDir, "as_of_"+*asOf)
+	}
+
+	if *paramsFile != "" {
+		if err := params.LoadRunFile(*paramsFile); err != nil {
+			logger.Fatal("ошибка загрузки параметров запросов", zap.Error(err))
+		}
+	}
+
+	resultFormats := splitList(*resultFormat)
+	if err := queries.CheckFormats(resultFormats); err != nil {
+		logger.Fatal("ошибка выбора формата результатов", zap.Error(err))
+	}
+
+	thresholds := explain.DefaultThresholds()
+	thresholds.RowsFactor = *rowsFactor
+	thresholds.TimeFactor = *timeFactor
+	planOptions := queries.PlanOptions{
+		BaselineDir:    *baselineDir,
+		UpdateBaseline: *updateBaseline,
+		Thresholds:     thresholds,
+	}
 
 	switch *mode {
 	case "import":
-		err = runImport(db, cfg, schemaPath, indexesPath, logger)
+		err = runImport(store, cfg, *reset, logger)
+	case "delta":
+		cfg.Delta = true
+		err = runImport(store, cfg, *reset, logger)
+	case "anonymize":
+		err = runAnonymize(store, cfg, logger)
+	case "export":
+		err = runExport(store, cfg, *exportDir, *exportFormat, exporter.ParquetOptions{
+			Partition:    *partition,
+			RowGroupRows: *rowGroupRows,
+		}, logger)
 	case "queries":
-		err = runQueries(db, queriesDir, resultsDir, logger)
+		if len(args) > 0 {
+			err = runQueryCatalog(store, args, *site, *asOf, params, resultFormats, planOptions, queriesDir, resultsDir, logger)
+		} else {
+			err = runQueries(store, *site, *asOf, params, resultFormats, planOptions, queriesDir, resultsDir, logger)
+		}
+	case "bench":
+		err = runBench(store, args, *site, *asOf, params, resultFormats, queriesDir, logger)
+	case "index-lab":
+		err = runIndexLab(store, args, *site, *asOf, params, resultFormats, queriesDir, resultsDir, logger)
 	case "analysis":
-		err = runAnalysis(db, queriesDir, resultsDir, logger)
+		err = runAnalysis(store, *site, *asOf, params, resultFormats, planOptions, queriesDir, resultsDir, logger)
 	case "all":
-		err = runAll(db, cfg, schemaPath, indexesPath, queriesDir, resultsDir, logger)
+		err = runAll(store, cfg, *site, *asOf, params, resultFormats, planOptions, *reset, queriesDir, resultsDir, logger)
+	case "migrate":
+		err = runMigrate(store, args, logger)
 	default:
-		logger.Fatal("неизвестный режим работы, используйте: import, queries, analysis или all")
+		logger.Fatal("неизвестный режим работы, используйте: import, delta, anonymize, export, queries, analysis, bench, index-lab, all или migrate")
 	}
 
 	if err != nil {
@@ -80,6 +186,16 @@ func main() {
 	logger.Info("работа завершена успешно")
 }
 
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func setupLogger() *zap.Logger {
 	cfg := zap.NewProductionConfig()
 	cfg.EncoderConfig.TimeKey = "time"
@@ -95,60 +211,119 @@ func setupLogger() *zap.Logger {
 	return logger
 }
 
-func connectToDatabase(cfg *config.Config, logger *zap.Logger) (*sqlx.DB, error) {
-	logger.Info("подключение к базе данных",
-		zap.String("host", cfg.Database.Host),
-		zap.Int("port", cfg.Database.Port),
-		zap.String("db", cfg.Database.Name))
+func connectToDatabase(cfg *config.Config, logger *zap.Logger) (database.Store, error) {
+	if cfg.Database.Driver == database.DriverSQLite {
+		logger.Info("открытие базы данных SQLite", zap.String("path", cfg.Database.Path))
+	} else {
+		logger.Info("подключение к базе данных",
+			zap.String("host", cfg.Database.Host),
+			zap.Int("port", cfg.Database.Port),
+			zap.String("db", cfg.Database.Name))
+	}
 
-	db, err := sqlx.Connect("postgres", cfg.Database.ConnString())
+	store, err := database.Open(&cfg.Database, logger)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
 	}
 
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Hour)
-
-	if err := db.Ping(); err != nil {
+	if err := store.DB().Ping(); err != nil {
+		store.Close()
 		return nil, fmt.Errorf("ошибка проверки соединения: %w", err)
 	}
 
-	logger.Info("успешное подключение к базе данных")
-	return db, nil
+	logger.Info("успешное подключение к базе данных", zap.String("driver", store.Driver()))
+	return store, nil
 }
 
-func runImport(db *sqlx.DB, cfg *config.Config, schemaPath, indexesPath string, logger *zap.Logger) error {
+// анонимизация и экспорт построены на возможностях Postgres
+func requirePostgres(store database.Store, mode string) error {
+	if store.Driver() != database.DriverPostgres {
+		return fmt.Errorf("режим %s поддерживается только в Postgres", mode)
+	}
+	return nil
+}
+
+// reset откатывает все миграции перед импортом; иначе существующие данные сохраняются
+func runImport(store database.Store, cfg *config.Config, reset bool, logger *zap.Logger) error {
 	logger.Info("начало импорта данных")
 
-	postgresDB, err := database.NewPostgresDB(&cfg.Database, logger)
-	if err != nil {
-		return err
+	ctx := context.Background()
+	if reset {
+		logger.Warn("удаление всех данных и объектов схемы")
+		if err := store.MigrateDown(ctx, 0); err != nil {
+			return err
+		}
 	}
-	defer postgresDB.Close()
 
-	if err := postgresDB.CreateSchema(schemaPath); err != nil {
+	if err := store.MigrateUp(ctx); err != nil {
 		return err
 	}
 
-	importer := importer.NewImporter(db, cfg, logger)
+	importer := importer.NewImporter(store, cfg, logger)
 
 	if err := importer.ImportAll(); err != nil {
 		return err
 	}
 
-	if err := postgresDB.CreateIndexes(indexesPath); err != nil {
+	logger.Info("импорт данных завершен успешно")
+	return nil
+}
+
+// анонимизирует уже загруженную базу по той же политике, что и импорт с --anonymize
+func runAnonymize(store database.Store, cfg *config.Config, logger *zap.Logger) error {
+	logger.Info("начало анонимизации данных")
+
+	if err := requirePostgres(store, "anonymize"); err != nil {
+		return err
+	}
+
+	policy, err := anonymize.LoadPolicy(cfg.AnonymizePolicy)
+	if err != nil {
+		return err
+	}
+	if policy.RandomSalt() {
+		logger.Warn("соль анонимизации не задана: псевдонимы будут другими при следующем запуске")
+	}
+
+	anonymizer := anonymize.NewAnonymizer(store.DB(), policy, cfg.BatchSize, logger)
+	if err := anonymizer.Run(context.Background()); err != nil {
 		return err
 	}
 
-	logger.Info("импорт данных завершен успешно")
+	logger.Info("анонимизация данных завершена успешно")
+	return nil
+}
+
+// выгружает сайты из базы в xml файлы формата дампов или в parquet;
+// cfg.Sites ограничивает выгрузку
+func runExport(store database.Store, cfg *config.Config, exportDir, format string, parquetOptions exporter.ParquetOptions, logger *zap.Logger) error {
+	logger.Info("начало экспорта данных", zap.String("dir", exportDir), zap.String("format", format))
+
+	if err := requirePostgres(store, "export"); err != nil {
+		return err
+	}
+
+	switch format {
+	case "xml":
+		if err := exporter.NewExporter(store.DB(), exportDir, cfg.Sites, logger).ExportAll(); err != nil {
+			return err
+		}
+	case "parquet":
+		if err := exporter.NewParquetExporter(store.DB(), exportDir, cfg.Sites, parquetOptions, logger).ExportAll(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("неизвестный формат выгрузки %q, используйте: xml или parquet", format)
+	}
+
+	logger.Info("экспорт данных завершен успешно")
 	return nil
 }
 
-func runQueries(db *sqlx.DB, queriesDir, resultsDir string, logger *zap.Logger) error {
+func runQueries(store database.Store, site, asOf string, params *queries.Params, formats []string, plans queries.PlanOptions, queriesDir, resultsDir string, logger *zap.Logger) error {
 	logger.Info("начало выполнения запросов")
 
-	queryRunner := queries.NewQueryRunner(db, logger)
+	queryRunner := queries.NewQueryRunner(store, site, asOf, params, formats, plans, logger)
 
 	if err := queryRunner.RunAllQueries(queriesDir, resultsDir); err != nil {
 		return err
@@ -158,22 +333,244 @@ func runQueries(db *sqlx.DB, queriesDir, resultsDir string, logger *zap.Logger)
 	return nil
 }
 
-func runAll(db *sqlx.DB, cfg *config.Config, schemaPath, indexesPath, queriesDir, resultsDir string, logger *zap.Logger) error {
-	if err := runImport(db, cfg, schemaPath, indexesPath, logger); err != nil {
+// queries list [--tag T] | describe <name> | run [--tag T] [--param имя=значение] [--params файл] [name...]:
+// работа с каталогом аналитических запросов из директории скриптов
+func runQueryCatalog(store database.Store, args []string, site, asOf string, params *queries.Params, formats []string, plans queries.PlanOptions, queriesDir, resultsDir string, logger *zap.Logger) error {
+	catalog, err := queries.LoadCatalog(queriesDir)
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("queries "+args[0], flag.ContinueOnError)
+	tag := flags.String("tag", "", "Отобрать запросы с тегом")
+	flags.Var(params, "param", "Параметр запросов имя=значение или запрос.имя=значение")
+	paramsFile := flags.String("params", "", "Файл запуска (yaml) со значениями параметров запросов")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *paramsFile != "" {
+		if err := params.LoadRunFile(*paramsFile); err != nil {
+			return err
+		}
+	}
+	names := flags.Args()
+
+	queryRunner := queries.NewQueryRunner(store, site, asOf, params, formats, plans, logger)
+
+	switch args[0] {
+	case "list":
+		selected, err := catalog.Select(nil, *tag)
+		if err != nil {
+			return err
+		}
+		for _, query := range selected {
+			runtime := "-"
+			if query.ExpectedRuntime > 0 {
+				runtime = query.ExpectedRuntime.String()
+			}
+			fmt.Printf("%-12s  %-8s  %-32s  %s\n",
+				query.Name, runtime, strings.Join(query.Tags, ","), query.Description)
+		}
+		return nil
+	case "describe":
+		if len(names) != 1 {
+			return fmt.Errorf("укажите один запрос: queries describe <name>")
+		}
+		query, err := catalog.Get(names[0])
+		if err != nil {
+			return err
+		}
+		variant := query.For(store.Driver())
+		missing, err := queryRunner.MissingObjects(context.Background(), variant)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Имя:        %s\n", query.Name)
+		fmt.Printf("Описание:   %s\n", query.Description)
+		fmt.Printf("Теги:       %s\n", strings.Join(query.Tags, ", "))
+		if query.ExpectedRuntime > 0 {
+			fmt.Printf("Время:      %s\n", query.ExpectedRuntime)
+		}
+		fmt.Printf("Файл:       %s\n", variant.Path)
+		if dialects := query.Dialects(); len(dialects) > 0 {
+			fmt.Printf("Диалекты:   %s\n", strings.Join(dialects, ", "))
+		}
+		fmt.Printf("Объекты:    %s\n", strings.Join(variant.Requires, ", "))
+		if variant.AllowWrites {
+			fmt.Printf("Запись:     разрешена\n")
+		}
+		for _, param := range variant.Params {
+			value := "обязательный"
+			if param.HasDefault {
+				value = "= " + param.Default
+			}
+			fmt.Printf("Параметр:   %s %s %s  %s\n", param.Name, param.Type, value, param.Description)
+		}
+		if len(missing) > 0 {
+			fmt.Printf("Нет в базе: %s\n", strings.Join(missing, ", "))
+		}
+		return nil
+	case "run":
+		selected, err := catalog.Select(names, *tag)
+		if err != nil {
+			return err
+		}
+		return queryRunner.RunCatalogQueries(selected, resultsDir)
+	}
+	return fmt.Errorf("неизвестная команда каталога запросов %q, используйте: list, describe или run", args[0])
+}
+
+// bench [--iterations N] [--warmup N] [--concurrency N] [--drop-cache] [--tag T] [name...]:
+// замер времени выполнения запросов каталога с сохранением истории в query_runs
+func runBench(store database.Store, args []string, site, asOf string, params *queries.Params, formats []string, queriesDir string, logger *zap.Logger) error {
+	catalog, err := queries.LoadCatalog(queriesDir)
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	iterations := flags.Int("iterations", 10, "Число замеряемых выполнений каждого запроса")
+	warmup := flags.Int("warmup", 2, "Число выполнений для прогрева перед замером")
+	concurrency := flags.Int("concurrency", 1, "Число соединений, одновременно выполняющих запрос")
+	dropCache := flags.Bool("drop-cache", false, "Выполнять каждый запрос в новом соединении после DISCARD ALL")
+	tag := flags.String("tag", "", "Отобрать запросы с тегом")
+	flags.Var(params, "param", "Параметр запросов имя=значение или запрос.имя=значение")
+	paramsFile := flags.String("params", "", "Файл запуска (yaml) со значениями параметров запросов")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *paramsFile != "" {
+		if err := params.LoadRunFile(*paramsFile); err != nil {
+			return err
+		}
+	}
+
+	selected, err := catalog.Select(flags.Args(), *tag)
+	if err != nil {
+		return err
+	}
+
+	// история замеров хранится в таблице query_runs
+	if err := store.MigrateUp(context.Background()); err != nil {
+		return err
+	}
+
+	queryRunner := queries.NewQueryRunner(store, site, asOf, params, formats, queries.PlanOptions{}, logger)
+	results, err := queryRunner.Bench(selected, queries.BenchOptions{
+		Iterations:  *iterations,
+		Warmup:      *warmup,
+		Concurrency: *concurrency,
+		DropCache:   *dropCache,
+		Revision:    gitRevision(),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-12s  %5s  %10s  %10s  %10s  %10s  %10s  %10s\n",
+		"query", "runs", "min", "median", "p95", "max", "hit", "read")
+	for _, result := range results {
+		hit, read := "-", "-"
+		if result.HasBuffers {
+			hit = strconv.FormatInt(result.SharedHitBlocks, 10)
+			read = strconv.FormatInt(result.SharedReadBlocks, 10)
+		}
+		fmt.Printf("%-12s  %5d  %10s  %10s  %10s  %10s  %10s  %10s\n",
+			result.Query, result.Iterations,
+			result.Min.Round(time.Microsecond), result.Median.Round(time.Microsecond),
+			result.P95.Round(time.Microsecond), result.Max.Round(time.Microsecond),
+			hit, read)
+	}
+	return nil
+}
+
+// index-lab --candidates файл [--combine N] [--runs N] [--min-gain P] [--tag T] [name...]:
+// замер запросов каталога с каждым набором индексов-кандидатов и отчёт с рейтингом наборов
+func runIndexLab(store database.Store, args []string, site, asOf string, params *queries.Params, formats []string, queriesDir, resultsDir string, logger *zap.Logger) error {
+	catalog, err := queries.LoadCatalog(queriesDir)
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("index-lab", flag.ContinueOnError)
+	candidatesFile := flags.String("candidates", "", "Файл с определениями индексов-кандидатов (CREATE INDEX ...;)")
+	combine := flags.Int("combine", 1, "Наибольшее число кандидатов, проверяемых вместе")
+	runs := flags.Int("runs", 3, "Число выполнений запроса в каждом замере после прогревочного")
+	minGain := flags.Float64("min-gain", 10, "Сокращение суммарного времени запросов (%), при котором набор рекомендуется")
+	tag := flags.String("tag", "", "Отобрать запросы с тегом")
+	flags.Var(params, "param", "Параметр запросов имя=значение или запрос.имя=значение")
+	paramsFile := flags.String("params", "", "Файл запуска (yaml) со значениями параметров запросов")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *candidatesFile == "" {
+		return fmt.Errorf("не указан файл индексов-кандидатов: index-lab --candidates <файл>")
+	}
+	if *paramsFile != "" {
+		if err := params.LoadRunFile(*paramsFile); err != nil {
+			return err
+		}
+	}
+
+	candidates, err := queries.LoadIndexCandidates(*candidatesFile)
+	if err != nil {
+		return err
+	}
+	selected, err := catalog.Select(flags.Args(), *tag)
+	if err != nil {
+		return err
+	}
+
+	queryRunner := queries.NewQueryRunner(store, site, asOf, params, formats, queries.PlanOptions{}, logger)
+	report, err := queryRunner.IndexLab(selected, candidates, queries.IndexLabOptions{
+		MaxCombination: *combine,
+		Runs:           *runs,
+		MinGain:        *minGain,
+	})
+	if err != nil {
+		return err
+	}
+
+	outputs, err := queryRunner.WriteIndexReport(report, resultsDir)
+	if err != nil {
+		return err
+	}
+
+	// колонки рейтинга: rank, indexes, size_bytes, build_ms, total_ms, baseline_ms, saved_pct, recommendation
+	fmt.Printf("%4s  %-48s  %12s  %10s  %10s  %8s  %s\n", "rank", "indexes", "size_bytes", "build_ms", "total_ms", "saved_%", "recommendation")
+	for _, row := range report.Ranking.Rows {
+		fmt.Printf("%4v  %-48v  %12v  %10v  %10v  %8v  %v\n", row[0], row[1], row[2], row[3], row[4], row[6], row[7])
+	}
+	logger.Info("отчёт эксперимента с индексами записан", zap.Strings("output", outputs))
+	return nil
+}
+
+// короткий хеш текущего коммита; пусто, если git недоступен
+func gitRevision() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func runAll(store database.Store, cfg *config.Config, site, asOf string, params *queries.Params, formats []string, plans queries.PlanOptions, reset bool, queriesDir, resultsDir string, logger *zap.Logger) error {
+	if err := runImport(store, cfg, reset, logger); err != nil {
 		return err
 	}
 
-	if err := runQueries(db, queriesDir, resultsDir, logger); err != nil {
+	if err := runQueries(store, site, asOf, params, formats, plans, queriesDir, resultsDir, logger); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func runAnalysis(db *sqlx.DB, queriesDir, resultsDir string, logger *zap.Logger) error {
+func runAnalysis(store database.Store, site, asOf string, params *queries.Params, formats []string, plans queries.PlanOptions, queriesDir, resultsDir string, logger *zap.Logger) error {
 	logger.Info("начало выполнения аналитических запросов")
 
-	queryRunner := queries.NewQueryRunner(db, logger)
+	queryRunner := queries.NewQueryRunner(store, site, asOf, params, formats, plans, logger)
 
 	if err := queryRunner.RunAllQueries(queriesDir, resultsDir); err != nil {
 		return err
@@ -182,3 +579,45 @@ func runAnalysis(db *sqlx.DB, queriesDir, resultsDir string, logger *zap.Logger)
 	logger.Info("выполнение аналитических запросов завершено успешно")
 	return nil
 }
+
+// migrate up | down [N|all] | status: управление версией схемы базы данных
+func runMigrate(store database.Store, args []string, logger *zap.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("не указана команда миграции, используйте: migrate up, migrate down [N|all] или migrate status")
+	}
+
+	var err error
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		return store.MigrateUp(ctx)
+	case "down":
+		// по умолчанию откатывается одна последняя миграция
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = 0
+			} else if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("неверное число миграций для отката %q", args[1])
+			}
+		}
+		return store.MigrateDown(ctx, steps)
+	case "status":
+		statuses, err := store.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "не применена"
+			if status.AppliedAt != nil {
+				state = "применена " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Modified {
+				state += " (скрипт изменён после применения)"
+			}
+			fmt.Printf("%04d  %-20s  %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("неизвестная команда миграции %q, используйте: up, down или status", args[0])
+}
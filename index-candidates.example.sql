@@ -0,0 +1,14 @@
+-- Индексы-кандидаты для эксперимента: index-lab --candidates index-candidates.example.sql
+-- Каждый индекс создаётся, замеряется с запросами каталога и удаляется;
+-- имена не должны совпадать с индексами схемы
+
+-- частичный индекс принятых ответов для q2
+CREATE INDEX idx_lab_answers_score ON posts (site, score) WHERE post_type_id = 2;
+
+-- вопросы с принятым ответом для q2
+CREATE INDEX idx_lab_questions_accepted ON posts (site, accepted_answer_id, creation_date)
+    WHERE post_type_id = 1 AND accepted_answer_id IS NOT NULL;
+
+-- ответы вопроса по дате для времени первого ответа в q1
+CREATE INDEX idx_lab_answers_parent_created ON posts (site, parent_id, creation_date)
+    WHERE post_type_id = 2;
@@ -0,0 +1,216 @@
+package anonymize
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const defaultBatchSize = 10000
+
+// Anonymizer применяет политику к уже загруженной базе: строки читаются
+// пачками по ключу и записываются обратно через временную таблицу
+type Anonymizer struct {
+	db        *sqlx.DB
+	policy    *Policy
+	batchSize int
+	logger    *zap.Logger
+}
+
+func NewAnonymizer(db *sqlx.DB, policy *Policy, batchSize int, logger *zap.Logger) *Anonymizer {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &Anonymizer{
+		db:        db,
+		policy:    policy,
+		batchSize: batchSize,
+		logger:    logger,
+	}
+}
+
+// таблица и её ключ для постраничного чтения
+type tableKey struct {
+	table string
+	key   []string
+}
+
+func (a *Anonymizer) Run(ctx context.Context) error {
+	tables := a.policy.Tables()
+	sort.Strings(tables)
+
+	var targets []tableKey
+	for _, table := range tables {
+		targets = append(targets, tableKey{table: table, key: []string{"site", "id"}})
+		// версии строк снимков хранят те же данные
+		targets = append(targets, tableKey{table: table + "_versions", key: []string{"site", "id", "valid_from"}})
+	}
+
+	for _, target := range targets {
+		var exists bool
+		if err := a.db.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", target.table); err != nil {
+			return fmt.Errorf("ошибка проверки таблицы %s: %w", target.table, err)
+		}
+		if !exists {
+			continue
+		}
+
+		table := strings.TrimSuffix(target.table, "_versions")
+		if err := a.anonymizeTable(ctx, target, table); err != nil {
+			return err
+		}
+	}
+
+	// значения отклонённых строк — исходные атрибуты дампа
+	if _, err := a.db.ExecContext(ctx, "UPDATE import_rejects SET value = NULL WHERE value IS NOT NULL"); err != nil {
+		return fmt.Errorf("ошибка очистки import_rejects: %w", err)
+	}
+	return nil
+}
+
+// policyTable задаёт набор политик: для таблицы версий это исходная таблица
+func (a *Anonymizer) anonymizeTable(ctx context.Context, target tableKey, policyTable string) error {
+	columns := a.policy.Columns(policyTable)
+	sort.Strings(columns)
+	selected := append(append([]string{}, target.key...), columns...)
+
+	a.logger.Info("анонимизация таблицы",
+		zap.String("table", target.table),
+		zap.Strings("columns", columns))
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM %s
+		WHERE (%s) > (%s)
+		ORDER BY %s
+		LIMIT %d`,
+		strings.Join(selected, ", "), target.table,
+		strings.Join(target.key, ", "), placeholders(len(target.key)),
+		strings.Join(target.key, ", "), a.batchSize)
+	first := fmt.Sprintf(`
+		SELECT %s FROM %s
+		ORDER BY %s
+		LIMIT %d`,
+		strings.Join(selected, ", "), target.table,
+		strings.Join(target.key, ", "), a.batchSize)
+
+	var last []interface{}
+	total := 0
+	for {
+		var rows *sqlx.Rows
+		var err error
+		if last == nil {
+			rows, err = a.db.QueryxContext(ctx, first)
+		} else {
+			rows, err = a.db.QueryxContext(ctx, query, last...)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка чтения %s: %w", target.table, err)
+		}
+
+		var batch [][]interface{}
+		for rows.Next() {
+			values, err := rows.SliceScan()
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка сканирования %s: %w", target.table, err)
+			}
+			for n, value := range values {
+				if b, ok := value.([]byte); ok {
+					values[n] = string(b)
+				}
+			}
+			batch = append(batch, values)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("ошибка чтения %s: %w", target.table, err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		last = append([]interface{}{}, batch[len(batch)-1][:len(target.key)]...)
+		for _, values := range batch {
+			a.policy.Apply(policyTable, selected, values)
+		}
+		if err := a.update(ctx, target, selected, batch); err != nil {
+			return err
+		}
+
+		total += len(batch)
+		a.logger.Debug("пачка анонимизирована",
+			zap.String("table", target.table),
+			zap.Int("rows", total))
+	}
+
+	a.logger.Info("таблица анонимизирована",
+		zap.String("table", target.table),
+		zap.Int("rows", total))
+	return nil
+}
+
+func placeholders(n int) string {
+	parts := make([]string, n)
+	for k := range parts {
+		parts[k] = fmt.Sprintf("$%d", k+1)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// записывает пачку через временную таблицу с теми же колонками
+func (a *Anonymizer) update(ctx context.Context, target tableKey, columns []string, batch [][]interface{}) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TEMP TABLE anonymized ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		strings.Join(columns, ", "), target.table))
+	if err != nil {
+		return fmt.Errorf("ошибка создания временной таблицы: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("anonymized", columns...))
+	if err != nil {
+		return fmt.Errorf("ошибка подготовки COPY: %w", err)
+	}
+	for _, values := range batch {
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			stmt.Close()
+			return fmt.Errorf("ошибка COPY строки: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return fmt.Errorf("ошибка завершения COPY: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("ошибка закрытия COPY: %w", err)
+	}
+
+	var assignments, join []string
+	for _, column := range columns[len(target.key):] {
+		assignments = append(assignments, fmt.Sprintf("%s = s.%s", column, column))
+	}
+	for _, key := range target.key {
+		join = append(join, fmt.Sprintf("t.%s = s.%s", key, key))
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s t SET %s FROM anonymized s WHERE %s",
+		target.table, strings.Join(assignments, ", "), strings.Join(join, " AND ")))
+	if err != nil {
+		return fmt.Errorf("ошибка обновления %s: %w", target.table, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+	return nil
+}
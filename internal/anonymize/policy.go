@@ -0,0 +1,281 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+	"stackexchange-data-analysis/internal/models"
+)
+
+// политики обработки колонок
+const (
+	// значение остаётся без изменений
+	Keep = "keep"
+	// значение удаляется: строки становятся пустыми, остальные типы NULL
+	Drop = "drop"
+	// значение заменяется псевдонимом, одинаковым для одного имени во всех таблицах
+	Pseudonym = "pseudonym"
+	// значение огрубляется: у текста остаётся последняя часть после запятой
+	// (страна в Location), у меток времени — месяц
+	Generalize = "generalize"
+	// из текста удаляются e-mail и URL, упоминания @имя вне блоков кода
+	// и поля DisplayName заменяются псевдонимами
+	Scrub = "scrub"
+)
+
+// политика по умолчанию; файл политики переопределяет её по колонкам
+var defaultColumns = map[string]map[string]string{
+	"users": {
+		"display_name": Pseudonym,
+		"about_me":     Drop,
+		"website_url":  Drop,
+		"location":     Generalize,
+	},
+	"posts": {
+		"body": Scrub,
+	},
+	"comments": {
+		"text": Scrub,
+	},
+	"post_history": {
+		"text":    Scrub,
+		"comment": Scrub,
+	},
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	urlPattern        = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s"'<>]+|\bwww\.[^\s"'<>]+`)
+	// @ после буквы, цифры или другого @ не упоминание: так не затрагиваются
+	// адреса и системные переменные T-SQL вроде @@ROWCOUNT
+	mentionPattern     = regexp.MustCompile(`(^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]{2,})`)
+	codeBlockPattern   = regexp.MustCompile(`(?is)<pre\b[^>]*>.*?</pre>|<code\b[^>]*>.*?</code>`)
+	displayNamePattern = regexp.MustCompile(`("DisplayName"\s*:\s*")((?:[^"\\]|\\.)*)(")`)
+)
+
+// Policy описывает обработку колонок таблиц при анонимизации
+type Policy struct {
+	salt       []byte
+	randomSalt bool
+	columns    map[string]map[string]string
+}
+
+type policyFile struct {
+	Salt    string
+	Columns map[string]map[string]string
+}
+
+// LoadPolicy читает файл политики (yaml) поверх политики по умолчанию;
+// пустой путь означает политику по умолчанию. Без соли псевдонимы
+// согласованы только в пределах одного запуска
+func LoadPolicy(path string) (*Policy, error) {
+	policy := &Policy{columns: make(map[string]map[string]string)}
+	for table, columns := range defaultColumns {
+		policy.columns[table] = make(map[string]string)
+		for column, action := range columns {
+			policy.columns[table][column] = action
+		}
+	}
+
+	var file policyFile
+	if path != "" {
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("ошибка чтения политики анонимизации: %w", err)
+		}
+		if err := v.Unmarshal(&file); err != nil {
+			return nil, fmt.Errorf("ошибка парсинга политики анонимизации: %w", err)
+		}
+	}
+
+	for table, columns := range file.Columns {
+		if !identifierPattern.MatchString(table) {
+			return nil, fmt.Errorf("неверное имя таблицы %q в политике анонимизации", table)
+		}
+		if policy.columns[table] == nil {
+			policy.columns[table] = make(map[string]string)
+		}
+		for column, action := range columns {
+			if !identifierPattern.MatchString(column) {
+				return nil, fmt.Errorf("неверное имя колонки %q в политике анонимизации", column)
+			}
+			switch action {
+			case Keep, Drop, Pseudonym, Generalize, Scrub:
+			default:
+				return nil, fmt.Errorf("неизвестная политика %q для колонки %s.%s", action, table, column)
+			}
+			policy.columns[table][column] = action
+		}
+	}
+
+	policy.salt = []byte(file.Salt)
+	if len(policy.salt) == 0 {
+		policy.randomSalt = true
+		policy.salt = make([]byte, 32)
+		if _, err := rand.Read(policy.salt); err != nil {
+			return nil, fmt.Errorf("ошибка генерации соли: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+// RandomSalt сообщает, что соль не задана в файле и сгенерирована для этого запуска
+func (p *Policy) RandomSalt() bool {
+	return p.randomSalt
+}
+
+// Columns возвращает колонки таблицы, которые нужно изменить
+func (p *Policy) Columns(table string) []string {
+	var columns []string
+	for column, action := range p.columns[table] {
+		if action != Keep {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// Tables возвращает таблицы, в которых есть изменяемые колонки
+func (p *Policy) Tables() []string {
+	var tables []string
+	for table := range p.columns {
+		if len(p.Columns(table)) > 0 {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// Apply изменяет значения строки таблицы на месте; columns задаёт имена колонок values
+func (p *Policy) Apply(table string, columns []string, values []interface{}) {
+	actions := p.columns[table]
+	if len(actions) == 0 {
+		return
+	}
+	for n, column := range columns {
+		if action, ok := actions[column]; ok && action != Keep {
+			values[n] = p.apply(action, values[n])
+		}
+	}
+}
+
+func (p *Policy) apply(action string, value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	if value == nil {
+		return nil
+	}
+	if action == Drop {
+		if _, ok := value.(string); !ok {
+			return nil
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return p.applyText(action, v)
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return p.applyText(action, *v)
+	case time.Time:
+		return applyTime(action, v)
+	case models.Time:
+		return models.Time{Time: applyTime(action, v.Time)}
+	case *models.Time:
+		if v == nil {
+			return nil
+		}
+		return &models.Time{Time: applyTime(action, v.Time)}
+	}
+	return value
+}
+
+func (p *Policy) applyText(action, text string) interface{} {
+	switch action {
+	case Drop:
+		return ""
+	case Pseudonym:
+		if text == "" {
+			return text
+		}
+		return p.pseudonym(text)
+	case Generalize:
+		parts := strings.Split(text, ",")
+		return strings.TrimSpace(parts[len(parts)-1])
+	case Scrub:
+		return p.scrub(text)
+	}
+	return text
+}
+
+func applyTime(action string, t time.Time) time.Time {
+	if action == Generalize {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// псевдоним зависит только от имени без пробелов и регистра, поэтому
+// "John Doe" в users и "@JohnDoe" в комментариях получают один псевдоним
+func (p *Policy) pseudonym(name string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(normalized))
+	return "user_" + hex.EncodeToString(mac.Sum(nil))[:10]
+}
+
+func (p *Policy) scrub(text string) string {
+	text = emailPattern.ReplaceAllString(text, "[email]")
+	text = urlPattern.ReplaceAllString(text, "[url]")
+	text = p.scrubMentions(text)
+	return displayNamePattern.ReplaceAllStringFunc(text, func(field string) string {
+		parts := displayNamePattern.FindStringSubmatch(field)
+		return parts[1] + p.pseudonym(parts[2]) + parts[3]
+	})
+}
+
+// заменяет упоминания @имя псевдонимами вне блоков <pre> и <code>: в коде
+// тела поста @ обозначает переменные SQL, а не пользователей
+func (p *Policy) scrubMentions(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, block := range codeBlockPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(p.replaceMentions(text[last:block[0]]))
+		b.WriteString(text[block[0]:block[1]])
+		last = block[1]
+	}
+	b.WriteString(p.replaceMentions(text[last:]))
+	return b.String()
+}
+
+func (p *Policy) replaceMentions(text string) string {
+	return mentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := mentionPattern.FindStringSubmatch(match)
+		// точка или дефис в конце упоминания обычно относятся к предложению
+		name := strings.TrimRight(parts[2], ".-")
+		if name == "" {
+			return match
+		}
+		return parts[1] + "@" + p.pseudonym(name) + parts[2][len(name):]
+	})
+}
@@ -0,0 +1,117 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestPolicy(t *testing.T, salt string) *Policy {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("salt: "+salt+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+// псевдоним, посчитанный независимо от Policy
+func expectedPseudonym(salt, name string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(strings.ToLower(strings.ReplaceAll(name, " ", ""))))
+	return "user_" + hex.EncodeToString(mac.Sum(nil))[:10]
+}
+
+func TestScrub(t *testing.T) {
+	const salt = "test-salt"
+	policy := loadTestPolicy(t, salt)
+	john := expectedPseudonym(salt, "John")
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "e-mail",
+			text: "пишите на john.doe+se@example.com.",
+			want: "пишите на [email].",
+		},
+		{
+			name: "URL",
+			text: "см. https://example.com/a?b=1 и www.example.org/x",
+			want: "см. [url] и [url]",
+		},
+		{
+			name: "упоминание",
+			text: "@John, спасибо",
+			want: "@" + john + ", спасибо",
+		},
+		{
+			name: "точка в конце упоминания относится к предложению",
+			text: "спросите @John.",
+			want: "спросите @" + john + ".",
+		},
+		{
+			name: "упоминание в блоке кода",
+			text: "<p>@John</p><pre><code>SELECT @John FROM t</code></pre><code>@John</code>",
+			want: "<p>@" + john + "</p><pre><code>SELECT @John FROM t</code></pre><code>@John</code>",
+		},
+		{
+			name: "переменные T-SQL вне блока кода",
+			text: "проверьте @@ROWCOUNT и a@b",
+			want: "проверьте @@ROWCOUNT и a@b",
+		},
+		{
+			name: "DisplayName в JSON",
+			text: `{"Id":1,"DisplayName":"John"}`,
+			want: `{"Id":1,"DisplayName":"` + john + `"}`,
+		},
+		{
+			name: "текст без персональных данных",
+			text: "обычный текст",
+			want: "обычный текст",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.scrub(tt.text); got != tt.want {
+				t.Errorf("получено:\n%s\nожидается:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	const salt = "test-salt"
+	policy := loadTestPolicy(t, salt)
+
+	// одно имя без пробелов и регистра получает один псевдоним во всех таблицах
+	if got, want := policy.pseudonym("John Doe"), expectedPseudonym(salt, "John Doe"); got != want {
+		t.Errorf("псевдоним %s, ожидается %s", got, want)
+	}
+	if policy.pseudonym("John Doe") != policy.pseudonym("johndoe") {
+		t.Error("псевдоним зависит от пробелов или регистра")
+	}
+	if policy.pseudonym("John Doe") != loadTestPolicy(t, salt).pseudonym("John Doe") {
+		t.Error("псевдонимы с одной солью различаются между запусками")
+	}
+	if policy.pseudonym("John Doe") == loadTestPolicy(t, "other-salt").pseudonym("John Doe") {
+		t.Error("псевдонимы с разной солью совпадают")
+	}
+	if policy.pseudonym("John Doe") == policy.pseudonym("Jane Doe") {
+		t.Error("разные имена получили один псевдоним")
+	}
+	if policy.RandomSalt() {
+		t.Error("соль из файла политики считается случайной")
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,9 +12,53 @@ type Config struct {
 	Database    DatabaseConfig
 	DataDir     string
 	Concurrency int
+	BatchSize   int `mapstructure:"batch_size"`
+	// сайты для импорта; пустой список означает все сайты, найденные в DataDir
+	Sites []string
+	// продолжать прерванный импорт с сохранённых контрольных точек
+	Resume bool
+	// читать xml файлы прямо из 7z архивов без распаковки на диск
+	StreamArchives bool `mapstructure:"stream_archives"`
+	// политика обработки некорректных строк: lenient, reject или strict
+	Validation string
+	// путь к NDJSON журналу отклонённых строк; по умолчанию таблица import_rejects
+	RejectLog string `mapstructure:"reject_log"`
+	// дельта-импорт нового дампа поверх сохранённых данных
+	Delta bool
+	// дата дампа в формате 2006-01-02; по умолчанию текущая дата
+	DumpDate string `mapstructure:"dump_date"`
+	// сохранять версии строк по снимкам дампов для запросов на дату (--as-of)
+	Snapshot bool
+	// число горутин разбора одного xml файла; 1 означает последовательный разбор
+	ParseWorkers int `mapstructure:"parse_workers"`
+	// размер диапазона файла для параллельного разбора, МиБ
+	ParseChunkMB int `mapstructure:"parse_chunk_mb"`
+	// порядок передачи строк при параллельном разборе: ordered или unordered
+	ParseOrder string `mapstructure:"parse_order"`
+	// анонимизировать персональные данные при импорте
+	Anonymize bool
+	// yaml файл с политикой анонимизации по колонкам; по умолчанию встроенная политика
+	AnonymizePolicy string `mapstructure:"anonymize_policy"`
+	// выборочный импорт постов и всего, что на них ссылается
+	Subset SubsetConfig
+}
+
+// фильтры выборочного импорта; пустые фильтры означают импорт всего дампа
+type SubsetConfig struct {
+	// теги постов; пост отбирается, если у него есть хотя бы один из тегов
+	Tags []string
+	// диапазон даты создания поста [From, To) в формате 2006-01-02
+	From string
+	To   string
+	// типы отбираемых постов; по умолчанию вопросы (1), ответы подтягиваются к вопросам
+	PostTypes []int `mapstructure:"post_types"`
 }
 
 type DatabaseConfig struct {
+	// драйвер хранилища: postgres или sqlite
+	Driver string
+	// файл базы SQLite
+	Path     string
 	Host     string
 	Port     int
 	User     string
@@ -23,6 +68,8 @@ type DatabaseConfig struct {
 }
 
 func setDefaults() {
+	viper.SetDefault("database.driver", "postgres")
+	viper.SetDefault("database.path", "./stackexchange.db")
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", 5432)
 	viper.SetDefault("database.user", "postgres")
@@ -31,6 +78,11 @@ func setDefaults() {
 	viper.SetDefault("database.sslmode", "disable")
 	viper.SetDefault("data_dir", "./data")
 	viper.SetDefault("concurrency", 4)
+	viper.SetDefault("batch_size", 10000)
+	viper.SetDefault("validation", "lenient")
+	viper.SetDefault("parse_workers", 1)
+	viper.SetDefault("parse_chunk_mb", 64)
+	viper.SetDefault("parse_order", "ordered")
 }
 
 func Load() (*Config, error) {
@@ -43,6 +95,8 @@ func Load() (*Config, error) {
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("APP")
 
+	viper.BindEnv("database.driver", "DB_DRIVER")
+	viper.BindEnv("database.path", "DB_PATH")
 	viper.BindEnv("database.host", "DB_HOST")
 	viper.BindEnv("database.port", "DB_PORT")
 	viper.BindEnv("database.user", "DB_USER")
@@ -51,6 +105,24 @@ func Load() (*Config, error) {
 	viper.BindEnv("database.sslmode", "DB_SSLMODE")
 	viper.BindEnv("data_dir", "DATA_DIR")
 	viper.BindEnv("concurrency", "CONCURRENCY")
+	viper.BindEnv("batch_size", "BATCH_SIZE")
+	viper.BindEnv("sites", "SITES")
+	viper.BindEnv("resume", "RESUME")
+	viper.BindEnv("stream_archives", "STREAM_ARCHIVES")
+	viper.BindEnv("validation", "VALIDATION")
+	viper.BindEnv("reject_log", "REJECT_LOG")
+	viper.BindEnv("delta", "DELTA")
+	viper.BindEnv("dump_date", "DUMP_DATE")
+	viper.BindEnv("snapshot", "SNAPSHOT")
+	viper.BindEnv("parse_workers", "PARSE_WORKERS")
+	viper.BindEnv("parse_chunk_mb", "PARSE_CHUNK_MB")
+	viper.BindEnv("parse_order", "PARSE_ORDER")
+	viper.BindEnv("anonymize", "ANONYMIZE")
+	viper.BindEnv("anonymize_policy", "ANONYMIZE_POLICY")
+	viper.BindEnv("subset.tags", "SUBSET_TAGS")
+	viper.BindEnv("subset.from", "SUBSET_FROM")
+	viper.BindEnv("subset.to", "SUBSET_TO")
+	viper.BindEnv("subset.post_types", "SUBSET_POST_TYPES")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -74,6 +146,26 @@ func Load() (*Config, error) {
 	}
 	cfg.DataDir = dataDir
 
+	if cfg.DumpDate == "" {
+		cfg.DumpDate = time.Now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", cfg.DumpDate); err != nil {
+		return nil, fmt.Errorf("неверная дата дампа %q, ожидается формат ГГГГ-ММ-ДД: %w", cfg.DumpDate, err)
+	}
+
+	for _, date := range []string{cfg.Subset.From, cfg.Subset.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("неверная дата выборки %q, ожидается формат ГГГГ-ММ-ДД: %w", date, err)
+		}
+	}
+
+	if cfg.ParseOrder != "ordered" && cfg.ParseOrder != "unordered" {
+		return nil, fmt.Errorf("неизвестный порядок разбора %q, используйте: ordered или unordered", cfg.ParseOrder)
+	}
+
 	return &cfg, nil
 }
 
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/sqlscript"
+)
+
+// миграции схемы встроены в бинарный файл: migrations/<driver>/NNNN_name.up.sql
+// и парный NNNN_name.down.sql. Каждая миграция применяется в своей транзакции
+// вместе с записью в schema_migrations
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// ключ рекомендательной блокировки, чтобы два процесса не применяли миграции одновременно
+const migrationLockKey = 7402181
+
+type migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus — состояние миграции в базе; AppliedAt пуст у неприменённых
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// скрипт миграции изменился после применения
+	Modified bool
+}
+
+type appliedMigration struct {
+	Version   int       `db:"version"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// применяет встроенные миграции драйвера к базе; lock включает
+// рекомендательную блокировку Postgres на время применения
+type migrator struct {
+	db     *sqlx.DB
+	driver string
+	lock   bool
+	logger *zap.Logger
+}
+
+func (m *migrator) load() ([]migration, error) {
+	dir := "migrations/" + m.driver + "/"
+	files, err := fs.Glob(migrationFiles, dir+"*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения списка миграций: %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, dir)
+		direction := ""
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("неверное имя файла миграции %s", base)
+		}
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+
+		prefix, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("неверное имя файла миграции %s, ожидается NNNN_name.up.sql", base)
+		}
+
+		script, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %w", base, err)
+		}
+
+		mg := byVersion[version]
+		if mg == nil {
+			mg = &migration{Version: version, Name: name}
+			byVersion[version] = mg
+		} else if mg.Name != name {
+			return nil, fmt.Errorf("у миграции %d разные имена: %s и %s", version, mg.Name, name)
+		}
+		if direction == "up" {
+			mg.up = string(script)
+		} else {
+			mg.down = string(script)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.up == "" || mg.down == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s нет пары up/down", mg.Version, mg.Name)
+		}
+		migrations = append(migrations, *mg)
+	}
+	sort.Slice(migrations, func(a, b int) bool {
+		return migrations[a].Version < migrations[b].Version
+	})
+	return migrations, nil
+}
+
+func checksum(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// соединение с рекомендательной блокировкой и таблицей schema_migrations
+func (m *migrator) conn(ctx context.Context) (*sqlx.Conn, error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения соединения: %w", err)
+	}
+
+	if m.lock {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ошибка блокировки миграций: %w", err)
+		}
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		m.release(conn)
+		return nil, fmt.Errorf("ошибка создания таблицы schema_migrations: %w", err)
+	}
+	return conn, nil
+}
+
+func (m *migrator) release(conn *sqlx.Conn) {
+	if m.lock {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}
+	conn.Close()
+}
+
+func appliedMigrations(ctx context.Context, conn *sqlx.Conn) (map[int]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := conn.SelectContext(ctx, &rows, "SELECT version, checksum, applied_at FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("ошибка чтения schema_migrations: %w", err)
+	}
+	applied := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// применяет все неприменённые миграции по возрастанию версий.
+// Миграции только добавляют объекты, поэтому обновление схемы не удаляет данные
+func (m *migrator) up(ctx context.Context) error {
+	migrations, err := m.load()
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.release(conn)
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, mg := range migrations {
+		if done, ok := applied[mg.Version]; ok {
+			if done.Checksum != checksum(mg.up) {
+				m.logger.Warn("миграция изменена после применения",
+					zap.Int("version", mg.Version),
+					zap.String("name", mg.Name))
+			}
+			continue
+		}
+
+		m.logger.Info("применение миграции", zap.Int("version", mg.Version), zap.String("name", mg.Name))
+		err := m.apply(ctx, conn, mg.up, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+				mg.Version, mg.Name, checksum(mg.up))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка применения миграции %04d_%s: %w", mg.Version, mg.Name, err)
+		}
+		count++
+	}
+
+	m.logger.Info("схема базы данных актуальна", zap.Int("applied", count))
+	return nil
+}
+
+// откатывает steps последних применённых миграций;
+// steps <= 0 откатывает все миграции и удаляет все данные
+func (m *migrator) down(ctx context.Context, steps int) error {
+	migrations, err := m.load()
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.release(conn)
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for n := len(migrations) - 1; n >= 0; n-- {
+		if steps > 0 && count == steps {
+			break
+		}
+		mg := migrations[n]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+
+		m.logger.Warn("откат миграции", zap.Int("version", mg.Version), zap.String("name", mg.Name))
+		err := m.apply(ctx, conn, mg.down, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mg.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка отката миграции %04d_%s: %w", mg.Version, mg.Name, err)
+		}
+		count++
+	}
+
+	m.logger.Info("откат миграций завершён", zap.Int("reverted", count))
+	return nil
+}
+
+func (m *migrator) apply(ctx context.Context, conn *sqlx.Conn, script string, record func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := sqlscript.Exec(ctx, tx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("ошибка записи в schema_migrations: %w", err)
+	}
+	return tx.Commit()
+}
+
+// возвращает все встроенные миграции драйвера и их состояние в базе
+func (m *migrator) status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.release(conn)
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, mg := range migrations {
+		status := MigrationStatus{Version: mg.Version, Name: mg.Name}
+		if done, ok := applied[mg.Version]; ok {
+			appliedAt := done.AppliedAt
+			status.AppliedAt = &appliedAt
+			status.Modified = done.Checksum != checksum(mg.up)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
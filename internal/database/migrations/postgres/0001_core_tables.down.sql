@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS votes CASCADE;
+DROP TABLE IF EXISTS tags CASCADE;
+DROP TABLE IF EXISTS post_links CASCADE;
+DROP TABLE IF EXISTS post_history CASCADE;
+DROP TABLE IF EXISTS comments CASCADE;
+DROP TABLE IF EXISTS posts CASCADE;
+DROP TABLE IF EXISTS badges CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
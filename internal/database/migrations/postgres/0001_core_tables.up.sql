@@ -0,0 +1,115 @@
+-- Базовая схема: таблицы дампа StackExchange.
+-- База, созданная до миграций, этой схеме не соответствует: в её таблицах нет
+-- колонки site и ключа (site, id), и следующие миграции на ней не выполнятся.
+-- Такую базу нужно создать заново и импортировать дамп повторно
+
+CREATE TABLE IF NOT EXISTS users (
+                                     site TEXT NOT NULL,
+                                     id INTEGER NOT NULL,
+                                     reputation INTEGER NOT NULL,
+                                     display_name TEXT NOT NULL,
+                                     about_me TEXT,
+                                     website_url TEXT,
+                                     location TEXT,
+                                     creation_date TIMESTAMP NOT NULL,
+                                     last_access_date TIMESTAMP,
+                                     views INTEGER DEFAULT 0,
+                                     up_votes INTEGER DEFAULT 0,
+                                     down_votes INTEGER DEFAULT 0,
+                                     account_id INTEGER,
+                                     PRIMARY KEY (site, id)
+);
+
+CREATE TABLE IF NOT EXISTS badges (
+                                      site TEXT NOT NULL,
+                                      id INTEGER NOT NULL,
+                                      user_id INTEGER NOT NULL,
+                                      name TEXT NOT NULL,
+                                      date TIMESTAMP NOT NULL,
+                                      class INTEGER,
+                                      tag_based BOOLEAN,
+                                      PRIMARY KEY (site, id)
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+                                     site TEXT NOT NULL,
+                                     id INTEGER NOT NULL,
+                                     post_type_id INTEGER NOT NULL,
+                                     accepted_answer_id INTEGER,
+                                     creation_date TIMESTAMP NOT NULL,
+                                     score INTEGER DEFAULT 0,
+                                     view_count INTEGER,
+                                     body TEXT,
+                                     owner_user_id INTEGER,
+                                     last_editor_user_id INTEGER,
+                                     last_edit_date TIMESTAMP,
+                                     last_activity_date TIMESTAMP,
+                                     title TEXT,
+                                     tags TEXT,
+                                     answer_count INTEGER DEFAULT 0,
+                                     comment_count INTEGER DEFAULT 0,
+                                     favorite_count INTEGER DEFAULT 0,
+                                     closed_date TIMESTAMP,
+                                     parent_id INTEGER,
+                                     community_owned_date TIMESTAMP,
+                                     PRIMARY KEY (site, id)
+);
+
+
+CREATE TABLE IF NOT EXISTS comments (
+                                        site TEXT NOT NULL,
+                                        id INTEGER NOT NULL,
+                                        post_id INTEGER NOT NULL,
+                                        user_id INTEGER,
+                                        score INTEGER DEFAULT 0,
+                                        text TEXT NOT NULL,
+                                        creation_date TIMESTAMP NOT NULL,
+                                        PRIMARY KEY (site, id)
+);
+
+
+CREATE TABLE IF NOT EXISTS post_history (
+                                            site TEXT NOT NULL,
+                                            id INTEGER NOT NULL,
+                                            post_id INTEGER NOT NULL,
+                                            user_id INTEGER,
+                                            post_history_type_id INTEGER NOT NULL,
+                                            revision_guid TEXT,
+                                            creation_date TIMESTAMP NOT NULL,
+                                            text TEXT,
+                                            comment TEXT,
+                                            PRIMARY KEY (site, id)
+);
+
+
+CREATE TABLE IF NOT EXISTS post_links (
+                                          site TEXT NOT NULL,
+                                          id INTEGER NOT NULL,
+                                          creation_date TIMESTAMP NOT NULL,
+                                          post_id INTEGER NOT NULL,
+                                          related_post_id INTEGER NOT NULL,
+                                          link_type_id INTEGER NOT NULL,
+                                          PRIMARY KEY (site, id)
+);
+
+
+CREATE TABLE IF NOT EXISTS tags (
+                                    site TEXT NOT NULL,
+                                    id INTEGER NOT NULL,
+                                    tag_name TEXT NOT NULL,
+                                    count INTEGER DEFAULT 0,
+                                    excerpt_post_id INTEGER,
+                                    wiki_post_id INTEGER,
+                                    PRIMARY KEY (site, id)
+);
+
+CREATE TABLE IF NOT EXISTS votes (
+                                     site TEXT NOT NULL,
+                                     id INTEGER NOT NULL,
+                                     post_id INTEGER NOT NULL,
+                                     vote_type_id INTEGER NOT NULL,
+                                     user_id INTEGER,
+                                     creation_date TIMESTAMP NOT NULL,
+                                     bounty_amount INTEGER,
+                                     PRIMARY KEY (site, id)
+);
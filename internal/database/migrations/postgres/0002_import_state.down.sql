@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS import_changes;
+DROP TABLE IF EXISTS deleted_rows;
+DROP TABLE IF EXISTS delta_seen;
+DROP TABLE IF EXISTS import_rejects;
+DROP TABLE IF EXISTS import_state;
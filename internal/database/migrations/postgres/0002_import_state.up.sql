@@ -0,0 +1,51 @@
+-- Состояние импорта файлов дампа для возобновления прерванного импорта
+CREATE TABLE IF NOT EXISTS import_state (
+                                            site TEXT NOT NULL,
+                                            file TEXT NOT NULL,
+                                            file_checksum TEXT NOT NULL,
+                                            last_id INTEGER NOT NULL DEFAULT 0,
+                                            status TEXT NOT NULL,
+                                            updated_at TIMESTAMP NOT NULL DEFAULT now(),
+                                            PRIMARY KEY (site, file)
+);
+
+-- Строки дампа, отклонённые при импорте (политика валидации reject)
+CREATE TABLE IF NOT EXISTS import_rejects (
+                                              id BIGSERIAL PRIMARY KEY,
+                                              site TEXT NOT NULL,
+                                              file TEXT NOT NULL,
+                                              line INTEGER NOT NULL,
+                                              byte_offset BIGINT NOT NULL,
+                                              attribute TEXT NOT NULL,
+                                              value TEXT,
+                                              error TEXT NOT NULL,
+                                              created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Дельта-импорт: id строк, встреченных в загружаемом дампе
+CREATE UNLOGGED TABLE IF NOT EXISTS delta_seen (
+                                                   site TEXT NOT NULL,
+                                                   entity TEXT NOT NULL,
+                                                   id INTEGER NOT NULL,
+                                                   PRIMARY KEY (site, entity, id)
+);
+
+-- Дельта-импорт: строки, пропавшие из очередного дампа (удалённый контент)
+CREATE TABLE IF NOT EXISTS deleted_rows (
+                                            site TEXT NOT NULL,
+                                            entity TEXT NOT NULL,
+                                            id INTEGER NOT NULL,
+                                            dump_date DATE NOT NULL,
+                                            PRIMARY KEY (site, entity, id, dump_date)
+);
+
+-- Дельта-импорт: итоги изменений по сущностям для каждого дампа
+CREATE TABLE IF NOT EXISTS import_changes (
+                                              site TEXT NOT NULL,
+                                              entity TEXT NOT NULL,
+                                              dump_date DATE NOT NULL,
+                                              inserted INTEGER NOT NULL,
+                                              updated INTEGER NOT NULL,
+                                              deleted INTEGER NOT NULL,
+                                              created_at TIMESTAMP NOT NULL DEFAULT now()
+);
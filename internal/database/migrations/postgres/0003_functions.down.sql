@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS current_site();
+DROP FUNCTION IF EXISTS extract_tags(TEXT);
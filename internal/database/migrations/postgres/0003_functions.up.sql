@@ -0,0 +1,28 @@
+-- Создаем функцию для извлечения тегов из строки tags формата '<tag1><tag2><tag3>'
+CREATE OR REPLACE FUNCTION extract_tags(tags_text TEXT)
+RETURNS TABLE(tag TEXT) AS $$
+BEGIN
+    IF tags_text IS NULL THEN
+        RETURN;
+END IF;
+
+RETURN QUERY
+SELECT
+    unnest(
+            string_to_array(
+                    regexp_replace(
+                            regexp_replace(tags_text, '[<>]', ' ', 'g'),
+                            '\s+', ' ', 'g'
+                    ),
+                    ' '
+            )
+    ) AS tag
+    WHERE length(tag) > 0;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Сайт, выбранный для анализа в текущей сессии (app.site); NULL означает все сайты
+CREATE OR REPLACE FUNCTION current_site()
+RETURNS TEXT AS $$
+    SELECT NULLIF(current_setting('app.site', true), '');
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,11 @@
+DROP SCHEMA IF EXISTS as_of CASCADE;
+DROP TABLE IF EXISTS users_versions;
+DROP TABLE IF EXISTS badges_versions;
+DROP TABLE IF EXISTS posts_versions;
+DROP TABLE IF EXISTS comments_versions;
+DROP TABLE IF EXISTS post_history_versions;
+DROP TABLE IF EXISTS post_links_versions;
+DROP TABLE IF EXISTS tags_versions;
+DROP TABLE IF EXISTS votes_versions;
+DROP TABLE IF EXISTS dumps;
+DROP FUNCTION IF EXISTS as_of_date();
@@ -0,0 +1,53 @@
+-- Снимки: загруженные дампы сайтов и их даты
+CREATE TABLE IF NOT EXISTS dumps (
+                                     dump_id SERIAL PRIMARY KEY,
+                                     site TEXT NOT NULL,
+                                     dump_date DATE NOT NULL,
+                                     created_at TIMESTAMP NOT NULL DEFAULT now(),
+                                     UNIQUE (site, dump_date)
+);
+
+-- Дата снимка, выбранная для анализа в текущей сессии (app.as_of)
+CREATE OR REPLACE FUNCTION as_of_date()
+RETURNS DATE AS $$
+    SELECT NULLIF(current_setting('app.as_of', true), '')::date;
+$$ LANGUAGE sql STABLE;
+
+CREATE SCHEMA IF NOT EXISTS as_of;
+
+-- Снимки: версии строк таблиц <table>_versions. Версия действует с valid_from
+-- (дата дампа, в котором строка появилась или изменилась) до valid_to (дата дампа,
+-- в котором строку изменили или удалили; NULL у текущей версии).
+-- Представления схемы as_of повторяют колонки таблиц и показывают их состояние
+-- на дату as_of_date(); запросы видят их через search_path = as_of, public
+DO $$
+DECLARE
+    t TEXT;
+    cols TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['users', 'badges', 'posts', 'comments', 'post_history', 'post_links', 'tags', 'votes']
+    LOOP
+        EXECUTE format('
+            CREATE TABLE IF NOT EXISTS %I (
+                LIKE %I,
+                dump_id INTEGER NOT NULL,
+                valid_from DATE NOT NULL,
+                valid_to DATE,
+                PRIMARY KEY (site, id, valid_from)
+            )', t || '_versions', t);
+        EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON %I (site, id) WHERE valid_to IS NULL',
+            'idx_' || t || '_versions_current', t || '_versions');
+
+        SELECT string_agg(quote_ident(column_name), ', ' ORDER BY ordinal_position)
+        INTO cols
+        FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = t;
+
+        EXECUTE format('
+            CREATE OR REPLACE VIEW as_of.%I AS
+            SELECT %s FROM %I.%I
+            WHERE valid_from <= as_of_date()
+            AND (valid_to IS NULL OR valid_to > as_of_date())',
+            t, cols, current_schema(), t || '_versions');
+    END LOOP;
+END $$;
@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS as_of.post_tags;
+DROP MATERIALIZED VIEW IF EXISTS post_tags;
@@ -0,0 +1,26 @@
+-- Теги постов: материализованное представление обновляется после импорта
+CREATE MATERIALIZED VIEW IF NOT EXISTS post_tags AS
+SELECT
+    p.site,
+    p.id AS post_id,
+    t.tag
+FROM
+    posts p,
+    LATERAL extract_tags(p.tags) t
+WHERE
+    p.tags IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(site, tag);
+CREATE INDEX IF NOT EXISTS idx_post_tags_post_id ON post_tags(site, post_id);
+
+-- Теги постов на дату снимка
+CREATE OR REPLACE VIEW as_of.post_tags AS
+SELECT
+    p.site,
+    p.id AS post_id,
+    t.tag
+FROM
+    as_of.posts p,
+    LATERAL extract_tags(p.tags) t
+WHERE
+    p.tags IS NOT NULL;
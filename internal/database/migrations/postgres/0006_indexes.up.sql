@@ -0,0 +1,22 @@
+-- Индексы для оптимизации запросов
+
+CREATE INDEX IF NOT EXISTS idx_users_reputation ON users(reputation);
+CREATE INDEX IF NOT EXISTS idx_users_creation_date ON users(creation_date);
+
+CREATE INDEX IF NOT EXISTS idx_posts_post_type_id ON posts(post_type_id);
+CREATE INDEX IF NOT EXISTS idx_posts_owner_user_id ON posts(site, owner_user_id);
+CREATE INDEX IF NOT EXISTS idx_posts_accepted_answer_id ON posts(site, accepted_answer_id);
+CREATE INDEX IF NOT EXISTS idx_posts_creation_date ON posts(creation_date);
+CREATE INDEX IF NOT EXISTS idx_posts_parent_id ON posts(site, parent_id);
+CREATE INDEX IF NOT EXISTS idx_posts_score ON posts(score);
+
+CREATE INDEX IF NOT EXISTS idx_posts_tags ON posts USING GIN (to_tsvector('english', tags));
+
+CREATE INDEX IF NOT EXISTS idx_votes_post_id ON votes(site, post_id);
+CREATE INDEX IF NOT EXISTS idx_votes_vote_type_id ON votes(vote_type_id);
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(site, post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(site, user_id);
+
+CREATE INDEX IF NOT EXISTS idx_badges_user_id ON badges(site, user_id);
+CREATE INDEX IF NOT EXISTS idx_badges_name ON badges(name);
@@ -0,0 +1,23 @@
+-- История замеров производительности аналитических запросов (режим bench):
+-- одна строка на запрос в каждом запуске
+CREATE TABLE IF NOT EXISTS query_runs (
+                                          id BIGSERIAL PRIMARY KEY,
+                                          run_id TEXT NOT NULL,
+                                          query TEXT NOT NULL,
+                                          file TEXT NOT NULL,
+                                          site TEXT,
+                                          driver TEXT NOT NULL,
+                                          git_revision TEXT,
+                                          config JSONB NOT NULL,
+                                          iterations INTEGER NOT NULL,
+                                          min_ms DOUBLE PRECISION NOT NULL,
+                                          median_ms DOUBLE PRECISION NOT NULL,
+                                          p95_ms DOUBLE PRECISION NOT NULL,
+                                          max_ms DOUBLE PRECISION NOT NULL,
+                                          mean_ms DOUBLE PRECISION NOT NULL,
+                                          shared_hit_blocks BIGINT,
+                                          shared_read_blocks BIGINT,
+                                          started_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_runs_query ON query_runs(query, started_at);
@@ -0,0 +1,23 @@
+-- Состояние импорта файлов дампа для возобновления прерванного импорта
+CREATE TABLE IF NOT EXISTS import_state (
+    site TEXT NOT NULL,
+    file TEXT NOT NULL,
+    file_checksum TEXT NOT NULL,
+    last_id INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (site, file)
+);
+
+-- Строки дампа, отклонённые при импорте (политика валидации reject)
+CREATE TABLE IF NOT EXISTS import_rejects (
+    id INTEGER PRIMARY KEY,
+    site TEXT NOT NULL,
+    file TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    byte_offset INTEGER NOT NULL,
+    attribute TEXT NOT NULL,
+    value TEXT,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
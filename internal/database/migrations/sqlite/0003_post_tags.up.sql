@@ -0,0 +1,10 @@
+-- Теги постов: в SQLite нет материализованных представлений, поэтому
+-- post_tags — обычная таблица, которая пересчитывается после импорта
+CREATE TABLE IF NOT EXISTS post_tags (
+    site TEXT NOT NULL,
+    post_id INTEGER NOT NULL,
+    tag TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(site, tag);
+CREATE INDEX IF NOT EXISTS idx_post_tags_post_id ON post_tags(site, post_id);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_users_reputation;
+DROP INDEX IF EXISTS idx_users_creation_date;
+DROP INDEX IF EXISTS idx_posts_post_type_id;
+DROP INDEX IF EXISTS idx_posts_owner_user_id;
+DROP INDEX IF EXISTS idx_posts_accepted_answer_id;
+DROP INDEX IF EXISTS idx_posts_creation_date;
+DROP INDEX IF EXISTS idx_posts_parent_id;
+DROP INDEX IF EXISTS idx_posts_score;
+DROP INDEX IF EXISTS idx_votes_post_id;
+DROP INDEX IF EXISTS idx_votes_vote_type_id;
+DROP INDEX IF EXISTS idx_comments_post_id;
+DROP INDEX IF EXISTS idx_comments_user_id;
+DROP INDEX IF EXISTS idx_badges_user_id;
+DROP INDEX IF EXISTS idx_badges_name;
@@ -0,0 +1,23 @@
+-- История замеров производительности аналитических запросов (режим bench):
+-- одна строка на запрос в каждом запуске
+CREATE TABLE IF NOT EXISTS query_runs (
+    id INTEGER PRIMARY KEY,
+    run_id TEXT NOT NULL,
+    query TEXT NOT NULL,
+    file TEXT NOT NULL,
+    site TEXT,
+    driver TEXT NOT NULL,
+    git_revision TEXT,
+    config TEXT NOT NULL,
+    iterations INTEGER NOT NULL,
+    min_ms REAL NOT NULL,
+    median_ms REAL NOT NULL,
+    p95_ms REAL NOT NULL,
+    max_ms REAL NOT NULL,
+    mean_ms REAL NOT NULL,
+    shared_hit_blocks INTEGER,
+    shared_read_blocks INTEGER,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_runs_query ON query_runs(query, started_at);
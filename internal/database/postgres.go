@@ -1,11 +1,10 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
 	"stackexchange-data-analysis/internal/config"
-	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -38,98 +37,100 @@ func (p *PostgresDB) Close() error {
 	return p.db.Close()
 }
 
-func (p *PostgresDB) CreateSchema(schemaPath string) error {
-	p.logger.Info("создание схемы базы данных")
+func (p *PostgresDB) Driver() string {
+	return DriverPostgres
+}
 
-	schema, err := ioutil.ReadFile(schemaPath)
-	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл схемы: %w", err)
-	}
+func (p *PostgresDB) DB() *sqlx.DB {
+	return p.db
+}
 
-	_, err = p.db.Exec(string(schema))
-	if err != nil {
-		return fmt.Errorf("ошибка при выполнении sql схемы: %w", err)
-	}
+func (p *PostgresDB) migrator() *migrator {
+	return &migrator{db: p.db, driver: DriverPostgres, lock: true, logger: p.logger}
+}
 
-	p.logger.Info("схема базы данных успешно создана")
-	return nil
+func (p *PostgresDB) MigrateUp(ctx context.Context) error {
+	return p.migrator().up(ctx)
 }
 
-func (p *PostgresDB) CreateIndexes(indexesPath string) error {
-	p.logger.Info("создание индексов")
+func (p *PostgresDB) MigrateDown(ctx context.Context, steps int) error {
+	return p.migrator().down(ctx, steps)
+}
 
-	indexes, err := ioutil.ReadFile(indexesPath)
-	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл индексов: %w", err)
-	}
+func (p *PostgresDB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return p.migrator().status(ctx)
+}
 
-	_, err = p.db.Exec(string(indexes))
+// сайт выбирается параметром сессии app.site, который читает current_site()
+func (p *PostgresDB) SessionConn(ctx context.Context, site string) (*sqlx.Conn, error) {
+	conn, err := p.db.Connx(ctx)
 	if err != nil {
-		return fmt.Errorf("ошибка при создании индексов: %w", err)
+		return nil, fmt.Errorf("ошибка получения соединения: %w", err)
 	}
 
-	p.logger.Info("индексы успешно созданы")
-	return nil
+	if _, err := conn.ExecContext(ctx, "SELECT set_config('app.site', $1, false)", site); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ошибка выбора сайта: %w", err)
+	}
+	return conn, nil
 }
 
-func (p *PostgresDB) ExecuteQueryFile(queryPath string) ([]map[string]interface{}, error) {
-	queryName := filepath.Base(queryPath)
-	p.logger.Info("выполнение запроса", zap.String("query", queryName))
-
-	queryBytes, err := ioutil.ReadFile(queryPath)
-	if err != nil {
-		return nil, fmt.Errorf("не удалось прочитать файл запроса: %w", err)
+func (p *PostgresDB) DiscardSession(ctx context.Context, conn *sqlx.Conn, site string) error {
+	if _, err := conn.ExecContext(ctx, "DISCARD ALL"); err != nil {
+		return fmt.Errorf("ошибка сброса сессии: %w", err)
 	}
-
-	queryStr := string(queryBytes)
-
-	parts := strings.Split(queryStr, "EXPLAIN ANALYZE")
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("запрос должен содержать EXPLAIN ANALYZE: %s", queryPath)
+	if _, err := conn.ExecContext(ctx, "SELECT set_config('app.site', $1, false)", site); err != nil {
+		return fmt.Errorf("ошибка выбора сайта: %w", err)
 	}
-	queryText := parts[1]
+	return nil
+}
 
-	planRows, err := p.db.Query(queryStr)
+func (p *PostgresDB) HasObject(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := p.db.GetContext(ctx, &exists, `
+		SELECT to_regclass($1) IS NOT NULL
+		    OR EXISTS (SELECT 1 FROM pg_proc WHERE proname = $1)
+	`, name)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
-	}
-	defer planRows.Close()
-
-	p.logger.Info("план запроса", zap.String("query", queryName))
-	for planRows.Next() {
-		var planLine string
-		if err := planRows.Scan(&planLine); err != nil {
-			return nil, fmt.Errorf("ошибка сканирования плана запроса: %w", err)
-		}
-		fmt.Println(planLine)
+		return false, fmt.Errorf("ошибка проверки объекта %s: %w", name, err)
 	}
+	return exists, nil
+}
 
-	if err = planRows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при обработке результатов плана: %w", err)
+func (p *PostgresDB) RelationSize(ctx context.Context, name string) (int64, error) {
+	var size sql.NullInt64
+	if err := p.db.GetContext(ctx, &size, "SELECT pg_relation_size(to_regclass($1))", name); err != nil {
+		return 0, fmt.Errorf("ошибка чтения размера %s: %w", name, err)
+	}
+	if !size.Valid {
+		return 0, fmt.Errorf("объект %s не найден", name)
 	}
+	return size.Int64, nil
+}
 
-	dataRows, err := p.db.Queryx(queryText)
+func (p *PostgresDB) RefreshDerived(ctx context.Context) error {
+	p.logger.Info("обновление материализованных представлений")
+
+	var exists bool
+	err := p.db.GetContext(ctx, &exists, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM pg_matviews
+			WHERE matviewname = 'post_tags'
+		)
+	`)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка выполнения запроса (без EXPLAIN): %w", err)
-	}
-	defer dataRows.Close()
-
-	var results []map[string]interface{}
-	for dataRows.Next() {
-		result := make(map[string]interface{})
-		if err := dataRows.MapScan(result); err != nil {
-			return nil, fmt.Errorf("ошибка сканирования результатов: %w", err)
-		}
-		results = append(results, result)
+		return fmt.Errorf("ошибка проверки существования представления: %w", err)
 	}
 
-	if err = dataRows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при обработке результатов запроса: %w", err)
+	if !exists {
+		p.logger.Warn("представление post_tags не найдено, обновление пропущено")
+		return nil
 	}
 
-	p.logger.Info("запрос выполнен успешно",
-		zap.String("query", queryName),
-		zap.Int("rows", len(results)))
-
-	return results, nil
+	if _, err := p.db.ExecContext(ctx, "REFRESH MATERIALIZED VIEW post_tags"); err != nil {
+		return fmt.Errorf("ошибка обновления материализованного представления: %w", err)
+	}
+	p.logger.Info("материализованное представление post_tags успешно обновлено")
+	return nil
 }
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+func (t Target) useStaging() bool {
+	return t.ConflictKey != ""
+}
+
+func (t Target) stagingTable() string {
+	return "staging_" + t.Table
+}
+
+func (t Target) mergeSQL() string {
+	columns := strings.Join(t.Columns, ", ")
+	return fmt.Sprintf(`
+		INSERT INTO %s (%s)
+		SELECT DISTINCT ON (%s) %s FROM %s
+		ORDER BY %s
+		ON CONFLICT (%s) %s`,
+		t.Table, columns,
+		t.ConflictKey, columns, t.stagingTable(),
+		t.ConflictKey,
+		t.ConflictKey, t.ConflictAction)
+}
+
+// слияние для дельта-импорта: новые строки вставляются, у существующих
+// обновляются все колонки, если хотя бы одна изменилась; id строк пачки
+// запоминаются в delta_seen для последующего поиска удалённых строк.
+// Возвращает количество вставленных и обновлённых строк
+func (t Target) deltaMergeSQL() string {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(t.ConflictKey, ",") {
+		keys[strings.TrimSpace(key)] = true
+	}
+
+	var updated, assignments []string
+	for _, column := range t.Columns {
+		if keys[column] {
+			continue
+		}
+		updated = append(updated, column)
+		assignments = append(assignments, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+
+	columns := strings.Join(t.Columns, ", ")
+	return fmt.Sprintf(`
+		WITH merged AS (
+			INSERT INTO %s AS t (%s)
+			SELECT DISTINCT ON (%s) %s FROM %s
+			ORDER BY %s
+			ON CONFLICT (%s) DO UPDATE SET %s
+			WHERE (t.%s) IS DISTINCT FROM (EXCLUDED.%s)
+			RETURNING (xmax = 0) AS inserted
+		), seen AS (
+			INSERT INTO delta_seen (site, entity, id)
+			SELECT site, '%s', id FROM %s
+			ON CONFLICT DO NOTHING
+		)
+		SELECT
+			count(*) FILTER (WHERE inserted),
+			count(*) FILTER (WHERE NOT inserted)
+		FROM merged`,
+		t.Table, columns,
+		t.ConflictKey, columns, t.stagingTable(),
+		t.ConflictKey,
+		t.ConflictKey, strings.Join(assignments, ", "),
+		strings.Join(updated, ", t."), strings.Join(updated, ", EXCLUDED."),
+		t.Table, t.stagingTable())
+}
+
+// пачка загружается через COPY; при слиянии — во временную staging-таблицу,
+// из которой строки переносятся INSERT ... ON CONFLICT
+func (p *PostgresDB) WriteBatch(ctx context.Context, target Target, rows [][]interface{}, afterBatch func(tx *sql.Tx) error) (WriteResult, error) {
+	var result WriteResult
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	copyTable := target.Table
+	if target.useStaging() || target.Delta {
+		copyTable = target.stagingTable()
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			"CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP",
+			copyTable, target.Table))
+		if err != nil {
+			return result, fmt.Errorf("ошибка создания staging-таблицы: %w", err)
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(copyTable, target.Columns...))
+	if err != nil {
+		return result, fmt.Errorf("ошибка подготовки COPY: %w", err)
+	}
+
+	for _, values := range rows {
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			stmt.Close()
+			return result, fmt.Errorf("ошибка COPY строки: %w", err)
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return result, fmt.Errorf("ошибка завершения COPY: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return result, fmt.Errorf("ошибка закрытия COPY: %w", err)
+	}
+
+	switch {
+	case target.Delta:
+		if err := tx.QueryRowContext(ctx, target.deltaMergeSQL()).Scan(&result.Inserted, &result.Updated); err != nil {
+			return result, fmt.Errorf("ошибка слияния staging-таблицы: %w", err)
+		}
+	case target.useStaging():
+		if _, err := tx.ExecContext(ctx, target.mergeSQL()); err != nil {
+			return result, fmt.Errorf("ошибка слияния staging-таблицы: %w", err)
+		}
+	}
+
+	if afterBatch != nil {
+		if err := afterBatch(tx); err != nil {
+			return result, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,351 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"modernc.org/sqlite"
+)
+
+// SQLiteDB — хранилище во встроенной SQLite (modernc.org/sqlite, без cgo) для
+// небольших сайтов. Дельта-импорт, снимки, анонимизация базы и экспорт
+// используют возможности Postgres и в SQLite недоступны
+type SQLiteDB struct {
+	db     *sqlx.DB
+	logger *zap.Logger
+}
+
+// сайт для current_site(): функции SQLite регистрируются на весь процесс,
+// а база встроенная и используется одним процессом, поэтому выбранный
+// сайт хранится в пакете
+var sqliteSite struct {
+	mu   sync.RWMutex
+	site string
+}
+
+var registerSQLiteFunctions sync.Once
+
+// функции Postgres, которые используют импорт и аналитические запросы
+func registerFunctions() error {
+	var err error
+	registerSQLiteFunctions.Do(func() {
+		sqlx.BindDriver(DriverSQLite, sqlx.QUESTION)
+
+		err = sqlite.RegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+			return time.Now().UTC().Format("2006-01-02 15:04:05.000"), nil
+		})
+		if err != nil {
+			return
+		}
+
+		err = sqlite.RegisterScalarFunction("current_site", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+			sqliteSite.mu.RLock()
+			defer sqliteSite.mu.RUnlock()
+			if sqliteSite.site == "" {
+				return nil, nil
+			}
+			return sqliteSite.site, nil
+		})
+		if err != nil {
+			return
+		}
+
+		err = sqlite.RegisterFunction("stddev", &sqlite.FunctionImpl{
+			NArgs:         1,
+			Deterministic: true,
+			MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+				return &statsAggregate{stddev: true}, nil
+			},
+		})
+		if err != nil {
+			return
+		}
+
+		err = sqlite.RegisterFunction("corr", &sqlite.FunctionImpl{
+			NArgs:         2,
+			Deterministic: true,
+			MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+				return &statsAggregate{}, nil
+			},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка регистрации функций SQLite: %w", err)
+	}
+	return nil
+}
+
+func NewSQLiteDB(path string, logger *zap.Logger) (*SQLiteDB, error) {
+	if err := registerFunctions(); err != nil {
+		return nil, err
+	}
+
+	// WAL позволяет читать во время записи; транзакции сразу берут блокировку
+	// записи и ждут её, а не падают с SQLITE_BUSY при параллельной загрузке сущностей
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(60000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	db, err := sqlx.Connect(DriverSQLite, "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть базу SQLite %s: %w", path, err)
+	}
+
+	return &SQLiteDB{
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+func (s *SQLiteDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteDB) Driver() string {
+	return DriverSQLite
+}
+
+func (s *SQLiteDB) DB() *sqlx.DB {
+	return s.db
+}
+
+func (s *SQLiteDB) migrator() *migrator {
+	return &migrator{db: s.db, driver: DriverSQLite, logger: s.logger}
+}
+
+func (s *SQLiteDB) MigrateUp(ctx context.Context) error {
+	return s.migrator().up(ctx)
+}
+
+func (s *SQLiteDB) MigrateDown(ctx context.Context, steps int) error {
+	return s.migrator().down(ctx, steps)
+}
+
+func (s *SQLiteDB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return s.migrator().status(ctx)
+}
+
+func (s *SQLiteDB) SessionConn(ctx context.Context, site string) (*sqlx.Conn, error) {
+	sqliteSite.mu.Lock()
+	sqliteSite.site = site
+	sqliteSite.mu.Unlock()
+
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения соединения: %w", err)
+	}
+	return conn, nil
+}
+
+// у встроенной базы нет состояния сессии на сервере: кэш страниц принадлежит
+// соединению и сбрасывается вместе с ним, поэтому выбирается только сайт
+func (s *SQLiteDB) DiscardSession(ctx context.Context, conn *sqlx.Conn, site string) error {
+	sqliteSite.mu.Lock()
+	sqliteSite.site = site
+	sqliteSite.mu.Unlock()
+	return nil
+}
+
+func (s *SQLiteDB) HasObject(ctx context.Context, name string) (bool, error) {
+	name = unqualified(name)
+	var exists bool
+	err := s.db.GetContext(ctx, &exists, `
+		SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE name = $1)
+		    OR EXISTS (SELECT 1 FROM pragma_function_list WHERE name = $1)
+	`, name)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки объекта %s: %w", name, err)
+	}
+	return exists, nil
+}
+
+// размер по страницам из виртуальной таблицы dbstat
+func (s *SQLiteDB) RelationSize(ctx context.Context, name string) (int64, error) {
+	name = unqualified(name)
+	var size sql.NullInt64
+	if err := s.db.GetContext(ctx, &size, "SELECT sum(pgsize) FROM dbstat WHERE name = $1", name); err != nil {
+		return 0, fmt.Errorf("ошибка чтения размера %s: %w", name, err)
+	}
+	if !size.Valid {
+		return 0, fmt.Errorf("объект %s не найден", name)
+	}
+	return size.Int64, nil
+}
+
+// имя объекта без схемы: sqlite_master и dbstat хранят имена без main.
+func unqualified(name string) string {
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// строки вставляются подготовленным INSERT ... ON CONFLICT в одной транзакции
+func (s *SQLiteDB) WriteBatch(ctx context.Context, target Target, rows [][]interface{}, afterBatch func(tx *sql.Tx) error) (WriteResult, error) {
+	var result WriteResult
+	if target.Delta {
+		return result, fmt.Errorf("дельта-импорт не поддерживается в SQLite")
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		target.Table, strings.Join(target.Columns, ", "), placeholders(len(target.Columns)))
+	if target.ConflictKey != "" {
+		query += fmt.Sprintf(" ON CONFLICT (%s) %s", target.ConflictKey, target.ConflictAction)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return result, fmt.Errorf("ошибка подготовки вставки: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, values := range rows {
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return result, fmt.Errorf("ошибка вставки строки: %w", err)
+		}
+	}
+
+	if afterBatch != nil {
+		if err := afterBatch(tx); err != nil {
+			return result, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+	return result, nil
+}
+
+// пересобирает таблицу post_tags: теги в форматах <a><b> и |a|b| разбираются
+// рекурсивным запросом
+func (s *SQLiteDB) RefreshDerived(ctx context.Context) error {
+	s.logger.Info("обновление таблицы post_tags")
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM post_tags"); err != nil {
+		return fmt.Errorf("ошибка очистки post_tags: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		WITH RECURSIVE split(site, post_id, tag, rest) AS (
+			SELECT site, id, '', replace(replace(tags, '<', '|'), '>', '|') || '|'
+			FROM posts
+			WHERE tags IS NOT NULL
+			UNION ALL
+			SELECT site, post_id,
+			       substr(rest, 1, instr(rest, '|') - 1),
+			       substr(rest, instr(rest, '|') + 1)
+			FROM split
+			WHERE rest <> ''
+		)
+		INSERT INTO post_tags (site, post_id, tag)
+		SELECT site, post_id, tag FROM split WHERE tag <> ''
+	`)
+	if err != nil {
+		return fmt.Errorf("ошибка заполнения post_tags: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+	s.logger.Info("таблица post_tags успешно обновлена")
+	return nil
+}
+
+// агрегаты stddev(x) (выборочное отклонение) и corr(x, y) как в Postgres;
+// строки с NULL в аргументах пропускаются
+type statsAggregate struct {
+	stddev                   bool
+	n                        float64
+	sumX, sumY, sumXX, sumYY float64
+	sumXY                    float64
+}
+
+func toFloat(value driver.Value) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (a *statsAggregate) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	x, ok := toFloat(args[0])
+	if !ok {
+		return nil
+	}
+	y := 0.0
+	if !a.stddev {
+		if y, ok = toFloat(args[1]); !ok {
+			return nil
+		}
+	}
+	a.n++
+	a.sumX += x
+	a.sumY += y
+	a.sumXX += x * x
+	a.sumYY += y * y
+	a.sumXY += x * y
+	return nil
+}
+
+func (a *statsAggregate) WindowInverse(_ *sqlite.FunctionContext, args []driver.Value) error {
+	x, ok := toFloat(args[0])
+	if !ok {
+		return nil
+	}
+	y := 0.0
+	if !a.stddev {
+		if y, ok = toFloat(args[1]); !ok {
+			return nil
+		}
+	}
+	a.n--
+	a.sumX -= x
+	a.sumY -= y
+	a.sumXX -= x * x
+	a.sumYY -= y * y
+	a.sumXY -= x * y
+	return nil
+}
+
+func (a *statsAggregate) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	varX := a.n*a.sumXX - a.sumX*a.sumX
+	if a.stddev {
+		if a.n < 2 {
+			return nil, nil
+		}
+		return math.Sqrt(math.Max(varX, 0) / (a.n * (a.n - 1))), nil
+	}
+
+	varY := a.n*a.sumYY - a.sumY*a.sumY
+	if a.n < 1 || varX <= 0 || varY <= 0 {
+		return nil, nil
+	}
+	return (a.n*a.sumXY - a.sumX*a.sumY) / math.Sqrt(varX*varY), nil
+}
+
+func (a *statsAggregate) Final(*sqlite.FunctionContext) {}
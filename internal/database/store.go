@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/config"
+)
+
+// драйверы хранилища
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Store — хранилище данных дампа: схема, запись сущностей и выполнение запросов.
+// Postgres — основная реализация; встроенная SQLite позволяет импортировать
+// и анализировать небольшой сайт без сервера базы данных
+type Store interface {
+	Driver() string
+	// DB возвращает соединение для кода, который пишет SQL напрямую
+	DB() *sqlx.DB
+
+	MigrateUp(ctx context.Context) error
+	MigrateDown(ctx context.Context, steps int) error
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+
+	// WriteBatch записывает пачку строк в одной транзакции; afterBatch
+	// вызывается внутри неё перед фиксацией
+	WriteBatch(ctx context.Context, target Target, rows [][]interface{}, afterBatch func(tx *sql.Tx) error) (WriteResult, error)
+	// RefreshDerived пересчитывает производные таблицы (post_tags) после импорта
+	RefreshDerived(ctx context.Context) error
+
+	// SessionConn возвращает соединение, в сессии которого выбран сайт для
+	// функции current_site(); пустая строка означает все сайты
+	SessionConn(ctx context.Context, site string) (*sqlx.Conn, error)
+	// DiscardSession сбрасывает состояние сессии соединения (кэш планов,
+	// временные таблицы, параметры) и заново выбирает сайт
+	DiscardSession(ctx context.Context, conn *sqlx.Conn, site string) error
+	// HasObject проверяет, есть ли в базе таблица, представление или функция
+	HasObject(ctx context.Context, name string) (bool, error)
+	// RelationSize возвращает размер таблицы или индекса на диске в байтах
+	RelationSize(ctx context.Context, name string) (int64, error)
+
+	Close() error
+}
+
+// Open открывает хранилище согласно database.driver
+func Open(cfg *config.DatabaseConfig, logger *zap.Logger) (Store, error) {
+	switch cfg.Driver {
+	case "", DriverPostgres:
+		return NewPostgresDB(cfg, logger)
+	case DriverSQLite:
+		return NewSQLiteDB(cfg.Path, logger)
+	}
+	return nil, fmt.Errorf("неизвестный драйвер базы данных %q, используйте: postgres или sqlite", cfg.Driver)
+}
+
+// Target описывает целевую таблицу пачки строк
+type Target struct {
+	Table   string
+	Columns []string
+	// ключ конфликта и действие при конфликте; пустой ConflictKey означает
+	// прямую вставку без слияния
+	ConflictKey    string
+	ConflictAction string
+	// слияние дельта-импорта: подсчёт вставленных и обновлённых строк
+	// и запись id пачки в delta_seen (только Postgres)
+	Delta bool
+}
+
+// WriteResult — итоги записи пачки; заполняется только при слиянии дельта-импорта
+type WriteResult struct {
+	Inserted int
+	Updated  int
+}
+
+func placeholders(n int) string {
+	parts := make([]string, n)
+	for k := range parts {
+		parts[k] = fmt.Sprintf("$%d", k+1)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,127 @@
+package explain
+
+import (
+	"fmt"
+	"math"
+)
+
+// виды регрессий плана
+const (
+	NodeChanged    = "node"
+	EstimateMissed = "estimate"
+	Slower         = "time"
+)
+
+// пороги сравнения плана с базовым
+type Thresholds struct {
+	// во сколько раз фактическое число строк узла может отличаться от оценки
+	RowsFactor float64
+	// во сколько раз может вырасти время выполнения запроса
+	TimeFactor float64
+	// рост времени меньше этого значения (мс) не считается регрессией
+	MinTimeDelta float64
+}
+
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		RowsFactor:   10,
+		TimeFactor:   1.5,
+		MinTimeDelta: 5,
+	}
+}
+
+// Regression — отличие плана от базового, ухудшающее выполнение запроса
+type Regression struct {
+	Kind    string
+	Path    string
+	Message string
+}
+
+func (r Regression) String() string {
+	if r.Path == "" {
+		return fmt.Sprintf("[%s] %s", r.Kind, r.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", r.Kind, r.Path, r.Message)
+}
+
+// узел чтения таблицы сопоставляется с базовым по таблице и псевдониму,
+// остальные узлы — по положению в дереве и типу
+func nodeKey(path string, node *Node) string {
+	if node.RelationName != "" {
+		return "scan:" + node.RelationName + ":" + node.Alias
+	}
+	return "node:" + path + ":" + node.NodeType
+}
+
+// во сколько раз фактическое число строк отличается от оценки; узлы,
+// которые не выполнялись, не учитываются
+func estimateError(node *Node) float64 {
+	if node.ActualLoops == 0 {
+		return 1
+	}
+	planned := math.Max(node.PlanRows, 1)
+	actual := math.Max(node.ActualRows, 1)
+	return math.Max(planned/actual, actual/planned)
+}
+
+// Compare сравнивает план с базовым: смену способа чтения таблиц (например,
+// Index Scan стал Seq Scan), новые промахи оценки числа строк и рост времени выполнения
+func Compare(baseline, current *Plan, thresholds Thresholds) []Regression {
+	var regressions []Regression
+
+	baseNodes := make(map[string]*Node)
+	baseline.Walk(func(path string, node *Node) {
+		baseNodes[nodeKey(path, node)] = node
+	})
+
+	current.Walk(func(path string, node *Node) {
+		base, ok := baseNodes[nodeKey(path, node)]
+
+		if ok && node.RelationName != "" && (base.NodeType != node.NodeType || base.IndexName != node.IndexName) {
+			regressions = append(regressions, Regression{
+				Kind:    NodeChanged,
+				Path:    path,
+				Message: fmt.Sprintf("%s вместо %s", node.Label(), base.Label()),
+			})
+		}
+
+		factor := estimateError(node)
+		if factor > thresholds.RowsFactor && (!ok || estimateError(base) <= thresholds.RowsFactor) {
+			regressions = append(regressions, Regression{
+				Kind: EstimateMissed,
+				Path: path,
+				Message: fmt.Sprintf("%s: оценка %.0f строк, фактически %.0f (в %.1f раза)",
+					node.Label(), node.PlanRows, node.ActualRows, factor),
+			})
+		}
+	})
+
+	// таблицы, которые читались в базовом плане и пропали из текущего,
+	// означают смену способа соединения
+	currentScans := make(map[string]bool)
+	current.Walk(func(path string, node *Node) {
+		if node.RelationName != "" {
+			currentScans[nodeKey(path, node)] = true
+		}
+	})
+	baseline.Walk(func(path string, node *Node) {
+		if node.RelationName != "" && !currentScans[nodeKey(path, node)] {
+			regressions = append(regressions, Regression{
+				Kind:    NodeChanged,
+				Path:    path,
+				Message: fmt.Sprintf("узел %s отсутствует в текущем плане", node.Label()),
+			})
+		}
+	})
+
+	delta := current.ExecutionTime - baseline.ExecutionTime
+	if current.ExecutionTime > baseline.ExecutionTime*thresholds.TimeFactor && delta > thresholds.MinTimeDelta {
+		regressions = append(regressions, Regression{
+			Kind: Slower,
+			Message: fmt.Sprintf("время выполнения %.3f мс вместо %.3f мс (в %.1f раза)",
+				current.ExecutionTime, baseline.ExecutionTime, current.ExecutionTime/math.Max(baseline.ExecutionTime, 0.001)),
+		})
+	}
+
+	return regressions
+}
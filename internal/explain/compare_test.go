@@ -0,0 +1,162 @@
+package explain
+
+import (
+	"testing"
+)
+
+func mustParse(t *testing.T, data string) *Plan {
+	t.Helper()
+	plan, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+const indexScanPlan = `[{
+	"Plan": {
+		"Node Type": "Index Scan", "Relation Name": "posts", "Alias": "p", "Index Name": "posts_owner_idx",
+		"Plan Rows": 100, "Actual Rows": 120, "Actual Loops": 1
+	},
+	"Planning Time": 0.2,
+	"Execution Time": 10
+}]`
+
+const seqScanPlan = `[{
+	"Plan": {
+		"Node Type": "Seq Scan", "Relation Name": "posts", "Alias": "p",
+		"Plan Rows": 100, "Actual Rows": 120, "Actual Loops": 1
+	},
+	"Planning Time": 0.2,
+	"Execution Time": 10
+}]`
+
+const estimateMissPlan = `[{
+	"Plan": {
+		"Node Type": "Index Scan", "Relation Name": "posts", "Alias": "p", "Index Name": "posts_owner_idx",
+		"Plan Rows": 100, "Actual Rows": 5000, "Actual Loops": 1
+	},
+	"Planning Time": 0.2,
+	"Execution Time": 10
+}]`
+
+const hashJoinPlan = `[{
+	"Plan": {
+		"Node Type": "Hash Join", "Plan Rows": 10, "Actual Rows": 10, "Actual Loops": 1,
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "posts", "Alias": "p", "Plan Rows": 10, "Actual Rows": 10, "Actual Loops": 1},
+			{"Node Type": "Hash", "Plan Rows": 10, "Actual Rows": 10, "Actual Loops": 1, "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "users", "Alias": "u", "Plan Rows": 10, "Actual Rows": 10, "Actual Loops": 1}
+			]}
+		]
+	},
+	"Planning Time": 0.2,
+	"Execution Time": 10
+}]`
+
+func withTime(plan *Plan, ms float64) *Plan {
+	copied := *plan
+	copied.ExecutionTime = ms
+	return &copied
+}
+
+func kinds(regressions []Regression) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range regressions {
+		counts[r.Kind]++
+	}
+	return counts
+}
+
+func TestCompare(t *testing.T) {
+	thresholds := DefaultThresholds()
+	index := mustParse(t, indexScanPlan)
+
+	tests := []struct {
+		name     string
+		baseline *Plan
+		current  *Plan
+		want     map[string]int
+	}{
+		{
+			name:     "тот же план",
+			baseline: index,
+			current:  index,
+			want:     map[string]int{},
+		},
+		{
+			name:     "Index Scan стал Seq Scan",
+			baseline: index,
+			current:  mustParse(t, seqScanPlan),
+			want:     map[string]int{NodeChanged: 1},
+		},
+		{
+			name:     "промах оценки строк больше порога",
+			baseline: index,
+			current:  mustParse(t, estimateMissPlan),
+			want:     map[string]int{EstimateMissed: 1},
+		},
+		{
+			name:     "промах оценки уже был в базовом плане",
+			baseline: mustParse(t, estimateMissPlan),
+			current:  mustParse(t, estimateMissPlan),
+			want:     map[string]int{},
+		},
+		{
+			name:     "таблица пропала из плана",
+			baseline: mustParse(t, hashJoinPlan),
+			current:  mustParse(t, seqScanPlan),
+			want:     map[string]int{NodeChanged: 1},
+		},
+		{
+			name:     "рост времени ниже коэффициента",
+			baseline: index,
+			current:  withTime(index, 14),
+			want:     map[string]int{},
+		},
+		{
+			name:     "рост времени выше коэффициента, но меньше минимальной разницы",
+			baseline: withTime(index, 2),
+			current:  withTime(index, 6),
+			want:     map[string]int{},
+		},
+		{
+			name:     "рост времени выше порога",
+			baseline: index,
+			current:  withTime(index, 25),
+			want:     map[string]int{Slower: 1},
+		},
+		{
+			name:     "ускорение не регрессия",
+			baseline: withTime(index, 100),
+			current:  index,
+			want:     map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regressions := Compare(tt.baseline, tt.current, thresholds)
+			got := kinds(regressions)
+			if len(got) != len(tt.want) {
+				t.Fatalf("регрессии %v, ожидается %v", regressions, tt.want)
+			}
+			for kind, count := range tt.want {
+				if got[kind] != count {
+					t.Fatalf("регрессии %v, ожидается %v", regressions, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareNodeChangedMessage(t *testing.T) {
+	regressions := Compare(mustParse(t, indexScanPlan), mustParse(t, seqScanPlan), DefaultThresholds())
+	if len(regressions) != 1 {
+		t.Fatalf("регрессии %v, ожидается одна", regressions)
+	}
+	want := "[node] 0: Seq Scan on posts p вместо Index Scan using posts_owner_idx on posts p"
+	if got := regressions[0].String(); got != want {
+		t.Errorf("получено %q, ожидается %q", got, want)
+	}
+}
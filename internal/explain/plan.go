@@ -0,0 +1,150 @@
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Prefix — вариант EXPLAIN, план которого разбирает пакет
+const Prefix = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "
+
+// TimingOffPrefix снимает план без времени узлов: время выполнения запроса и
+// буферы остаются, а накладные расходы замера меньше
+const TimingOffPrefix = "EXPLAIN (ANALYZE, BUFFERS, TIMING OFF, FORMAT JSON) "
+
+// план запроса из вывода EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON); время в миллисекундах
+type Plan struct {
+	Root          Node    `json:"Plan"`
+	PlanningTime  float64 `json:"Planning Time"`
+	ExecutionTime float64 `json:"Execution Time"`
+}
+
+// узел плана. Число строк — на один цикл выполнения узла
+type Node struct {
+	NodeType           string  `json:"Node Type"`
+	ParentRelationship string  `json:"Parent Relationship,omitempty"`
+	JoinType           string  `json:"Join Type,omitempty"`
+	Strategy           string  `json:"Strategy,omitempty"`
+	RelationName       string  `json:"Relation Name,omitempty"`
+	Alias              string  `json:"Alias,omitempty"`
+	IndexName          string  `json:"Index Name,omitempty"`
+	StartupCost        float64 `json:"Startup Cost"`
+	TotalCost          float64 `json:"Total Cost"`
+	PlanRows           float64 `json:"Plan Rows"`
+	ActualStartupTime  float64 `json:"Actual Startup Time"`
+	ActualTotalTime    float64 `json:"Actual Total Time"`
+	ActualRows         float64 `json:"Actual Rows"`
+	ActualLoops        float64 `json:"Actual Loops"`
+	SharedHitBlocks    int64   `json:"Shared Hit Blocks"`
+	SharedReadBlocks   int64   `json:"Shared Read Blocks"`
+	Plans              []Node  `json:"Plans,omitempty"`
+}
+
+// Parse разбирает вывод EXPLAIN (FORMAT JSON): массив из одного плана
+func Parse(data []byte) (*Plan, error) {
+	var plans []Plan
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("ошибка разбора плана запроса: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("пустой план запроса")
+	}
+	return &plans[0], nil
+}
+
+// ParseAutoExplain разбирает сообщение auto_explain с log_format = json:
+// "duration: 12.345 ms  plan:\n{...}". План возвращается и в формате вывода
+// EXPLAIN (FORMAT JSON), чтобы его можно было сохранить и сравнить с базовым;
+// время выполнения берётся из duration
+func ParseAutoExplain(message string) ([]byte, *Plan, error) {
+	var duration float64
+	if _, err := fmt.Sscanf(message, "duration: %f ms", &duration); err != nil {
+		return nil, nil, fmt.Errorf("сообщение auto_explain без длительности: %w", err)
+	}
+	start := strings.IndexByte(message, '{')
+	if start < 0 {
+		return nil, nil, fmt.Errorf("сообщение auto_explain без плана в формате JSON")
+	}
+
+	var output map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(message[start:]), &output); err != nil {
+		return nil, nil, fmt.Errorf("ошибка разбора плана запроса: %w", err)
+	}
+	if _, ok := output["Plan"]; !ok {
+		return nil, nil, fmt.Errorf("пустой план запроса")
+	}
+	// текста запроса в выводе EXPLAIN нет
+	delete(output, "Query Text")
+	if _, ok := output["Execution Time"]; !ok {
+		output["Execution Time"] = json.RawMessage(fmt.Sprintf("%.3f", duration))
+	}
+
+	data, err := json.MarshalIndent([]map[string]json.RawMessage{output}, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка записи плана запроса: %w", err)
+	}
+	plan, err := Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, plan, nil
+}
+
+// Walk обходит узлы плана в глубину; path — индексы узла от корня, например "0.1.0"
+func (p *Plan) Walk(visit func(path string, node *Node)) {
+	walk("0", &p.Root, visit)
+}
+
+func walk(path string, node *Node, visit func(string, *Node)) {
+	visit(path, node)
+	for n := range node.Plans {
+		walk(fmt.Sprintf("%s.%d", path, n), &node.Plans[n], visit)
+	}
+}
+
+// описание узла: тип, таблица и индекс
+func (n *Node) Label() string {
+	label := n.NodeType
+	if n.IndexName != "" {
+		label += " using " + n.IndexName
+	}
+	if n.RelationName != "" {
+		label += " on " + n.RelationName
+		if n.Alias != "" && n.Alias != n.RelationName {
+			label += " " + n.Alias
+		}
+	}
+	return label
+}
+
+// Format выводит план деревом в виде, близком к текстовому EXPLAIN ANALYZE
+func (p *Plan) Format(w io.Writer) error {
+	var err error
+	var format func(node *Node, depth int)
+	format = func(node *Node, depth int) {
+		if err != nil {
+			return
+		}
+		indent := strings.Repeat("      ", depth)
+		if depth > 0 {
+			indent = indent[:len(indent)-6] + "  ->  "
+		}
+		_, err = fmt.Fprintf(w, "%s%s  (cost=%.2f..%.2f rows=%.0f) (actual time=%.3f..%.3f rows=%.0f loops=%.0f) buffers: hit=%d read=%d\n",
+			indent, node.Label(),
+			node.StartupCost, node.TotalCost, node.PlanRows,
+			node.ActualStartupTime, node.ActualTotalTime, node.ActualRows, node.ActualLoops,
+			node.SharedHitBlocks, node.SharedReadBlocks)
+		for n := range node.Plans {
+			format(&node.Plans[n], depth+1)
+		}
+	}
+	format(&p.Root, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Planning Time: %.3f ms\nExecution Time: %.3f ms\n", p.PlanningTime, p.ExecutionTime)
+	return err
+}
@@ -0,0 +1,57 @@
+package explain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAutoExplain(t *testing.T) {
+	message := "duration: 12.345 ms  plan:\n" + `{
+  "Query Text": "SELECT * FROM posts WHERE owner_user_id = $1",
+  "Plan": {
+    "Node Type": "Gather",
+    "Plan Rows": 10, "Actual Rows": 8, "Actual Loops": 1,
+    "Plans": [
+      {"Node Type": "Seq Scan", "Parent Relationship": "Outer", "Relation Name": "posts", "Alias": "posts",
+       "Plan Rows": 5, "Actual Rows": 4, "Actual Loops": 2}
+    ]
+  }
+}`
+
+	data, plan, err := ParseAutoExplain(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.ExecutionTime != 12.345 {
+		t.Errorf("время выполнения %.3f, ожидается 12.345", plan.ExecutionTime)
+	}
+	if plan.Root.NodeType != "Gather" || len(plan.Root.Plans) != 1 || plan.Root.Plans[0].Label() != "Seq Scan on posts" {
+		t.Errorf("неверный план: %+v", plan.Root)
+	}
+	if strings.Contains(string(data), "Query Text") {
+		t.Error("текст запроса сохранён в плане")
+	}
+
+	// сохранённый план читается так же, как вывод EXPLAIN
+	reparsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reparsed.ExecutionTime != plan.ExecutionTime || reparsed.Root.NodeType != plan.Root.NodeType {
+		t.Errorf("план после сохранения %+v, ожидается %+v", reparsed, plan)
+	}
+}
+
+func TestParseAutoExplainErrors(t *testing.T) {
+	tests := []string{
+		"LOG:  something else",
+		"duration: 1.000 ms  plan:\nQuery Text: SELECT 1",
+		"duration: 1.000 ms  plan:\n{\"Query Text\": \"SELECT 1\"}",
+		"duration: 1.000 ms  plan:\n{\"Plan\": ",
+	}
+	for _, message := range tests {
+		if _, _, err := ParseAutoExplain(message); err == nil {
+			t.Errorf("ожидается ошибка для %q", message)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/models"
+)
+
+// сущности дампа в порядке файлов; атрибуты и колонки берутся из тегов моделей
+var entities = []struct {
+	name  string
+	table string
+	model interface{}
+}{
+	{"Users", "users", models.User{}},
+	{"Posts", "posts", models.Post{}},
+	{"Comments", "comments", models.Comment{}},
+	{"Badges", "badges", models.Badge{}},
+	{"PostHistory", "post_history", models.PostHistory{}},
+	{"PostLinks", "post_links", models.PostLink{}},
+	{"Tags", "tags", models.Tag{}},
+	{"Votes", "votes", models.Vote{}},
+}
+
+// атрибут элемента row и соответствующая ему колонка таблицы
+type attribute struct {
+	name      string
+	column    string
+	omitempty bool
+}
+
+func modelAttributes(t reflect.Type) []attribute {
+	var attributes []attribute
+	for n := 0; n < t.NumField(); n++ {
+		field := t.Field(n)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			attributes = append(attributes, modelAttributes(field.Type)...)
+			continue
+		}
+
+		column := field.Tag.Get("db")
+		parts := strings.Split(field.Tag.Get("xml"), ",")
+		if column == "" || len(parts) < 2 || parts[1] != "attr" {
+			continue
+		}
+
+		omitempty := false
+		for _, option := range parts[2:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		attributes = append(attributes, attribute{name: parts[0], column: column, omitempty: omitempty})
+	}
+	return attributes
+}
+
+// Exporter выгружает таблицы обратно в xml файлы формата дампов Stack Exchange:
+// те же имена и порядок атрибутов, формат меток времени и экранирование, что
+// у исходных дампов; NULL и пустые необязательные атрибуты не записываются.
+// Атрибуты, которые импорт не сохраняет (например, ContentLicense), теряются
+type Exporter struct {
+	db        *sqlx.DB
+	outputDir string
+	sites     []string
+	logger    *zap.Logger
+}
+
+// sites ограничивает выгрузку; пустой список означает все сайты в базе
+func NewExporter(db *sqlx.DB, outputDir string, sites []string, logger *zap.Logger) *Exporter {
+	return &Exporter{
+		db:        db,
+		outputDir: outputDir,
+		sites:     sites,
+		logger:    logger,
+	}
+}
+
+func (e *Exporter) ExportAll() error {
+	ctx := context.Background()
+
+	sites := e.sites
+	if len(sites) == 0 {
+		err := e.db.SelectContext(ctx, &sites, `
+			SELECT site FROM users
+			UNION
+			SELECT site FROM posts
+			ORDER BY site
+		`)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения списка сайтов: %w", err)
+		}
+	}
+	if len(sites) == 0 {
+		return fmt.Errorf("в базе нет данных для экспорта")
+	}
+
+	for _, site := range sites {
+		dir := filepath.Join(e.outputDir, site)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("не удалось создать директорию экспорта: %w", err)
+		}
+
+		for _, entity := range entities {
+			path := filepath.Join(dir, entity.name+".xml")
+			attributes := modelAttributes(reflect.TypeOf(entity.model))
+			if err := e.exportTable(ctx, site, entity.table, path, attributes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) exportTable(ctx context.Context, site, table, path string, attributes []attribute) error {
+	columns := make([]string, len(attributes))
+	for n, attr := range attributes {
+		columns[n] = attr.column
+	}
+
+	rows, err := e.db.QueryxContext(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE site = $1 ORDER BY id",
+		strings.Join(columns, ", "), table), site)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл экспорта: %w", err)
+	}
+	defer file.Close()
+
+	// корневой элемент — имя файла в нижнем регистре: <posts>, <posthistory>
+	root := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".xml"))
+	w := bufio.NewWriterSize(file, 1<<20)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n<%s>\r\n", root)
+
+	count := 0
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return fmt.Errorf("ошибка сканирования %s: %w", table, err)
+		}
+
+		w.WriteString("  <row")
+		for n, attr := range attributes {
+			value, ok := formatValue(values[n])
+			if !ok || (value == "" && attr.omitempty) {
+				continue
+			}
+			w.WriteString(" ")
+			w.WriteString(attr.name)
+			w.WriteString(`="`)
+			writeEscaped(w, value)
+			w.WriteString(`"`)
+		}
+		w.WriteString(" />\r\n")
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", table, err)
+	}
+
+	fmt.Fprintf(w, "</%s>", root)
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("ошибка записи файла экспорта: %w", err)
+	}
+
+	e.logger.Info("таблица выгружена",
+		zap.String("site", site),
+		zap.String("table", table),
+		zap.String("file", path),
+		zap.Int("rows", count))
+	return nil
+}
+
+// форматирует значение колонки как в дампах; false означает NULL
+func formatValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case []byte:
+		return string(v), true
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		if v {
+			return "True", true
+		}
+		return "False", true
+	case time.Time:
+		return v.Format(models.TimeLayout), true
+	}
+	return fmt.Sprint(value), true
+}
+
+// экранирует значение атрибута так же, как генератор дампов:
+// кавычки, амперсанд, угловые скобки и управляющие символы
+func writeEscaped(w *bufio.Writer, value string) {
+	for _, r := range value {
+		switch r {
+		case '&':
+			w.WriteString("&amp;")
+		case '<':
+			w.WriteString("&lt;")
+		case '>':
+			w.WriteString("&gt;")
+		case '"':
+			w.WriteString("&quot;")
+		case '\n':
+			w.WriteString("&#xA;")
+		case '\r':
+			w.WriteString("&#xD;")
+		case '\t':
+			w.WriteString("&#x9;")
+		default:
+			w.WriteRune(r)
+		}
+	}
+}
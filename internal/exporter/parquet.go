@@ -0,0 +1,383 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+)
+
+// схемы раскладки parquet файлов по директориям
+const (
+	// один файл на таблицу: <dir>/<table>.parquet
+	PartitionNone = "none"
+	// hive-разбиение по сайтам: <dir>/<table>/site=<site>/part-0.parquet
+	PartitionSite = "site"
+	// по сайтам и годам даты создания: <dir>/<table>/site=<site>/year=<year>/part-0.parquet
+	PartitionSiteYear = "site-year"
+)
+
+const defaultRowGroupRows = 1000000
+
+// таблицы для выгрузки в parquet, включая производные
+var parquetTables = []string{
+	"users", "posts", "comments", "badges", "post_history",
+	"post_links", "tags", "votes", "post_tags",
+}
+
+type ParquetOptions struct {
+	Partition string
+	// максимальное число строк в группе строк
+	RowGroupRows int64
+}
+
+// ParquetExporter выгружает таблицы в parquet файлы с типами и допустимостью NULL
+// из каталога базы; строки читаются потоком и пишутся группами строк
+type ParquetExporter struct {
+	db        *sqlx.DB
+	outputDir string
+	sites     []string
+	options   ParquetOptions
+	logger    *zap.Logger
+}
+
+func NewParquetExporter(db *sqlx.DB, outputDir string, sites []string, options ParquetOptions, logger *zap.Logger) *ParquetExporter {
+	if options.Partition == "" {
+		options.Partition = PartitionNone
+	}
+	if options.RowGroupRows <= 0 {
+		options.RowGroupRows = defaultRowGroupRows
+	}
+	return &ParquetExporter{
+		db:        db,
+		outputDir: outputDir,
+		sites:     sites,
+		options:   options,
+		logger:    logger,
+	}
+}
+
+// колонка таблицы из каталога pg_attribute
+type tableColumn struct {
+	Name     string `db:"name"`
+	Type     string `db:"type"`
+	Nullable bool   `db:"nullable"`
+}
+
+func (e *ParquetExporter) ExportAll() error {
+	switch e.options.Partition {
+	case PartitionNone, PartitionSite, PartitionSiteYear:
+	default:
+		return fmt.Errorf("неизвестная схема разбиения %q, используйте: none, site или site-year", e.options.Partition)
+	}
+
+	ctx := context.Background()
+	for _, table := range parquetTables {
+		var exists bool
+		if err := e.db.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", table); err != nil {
+			return fmt.Errorf("ошибка проверки таблицы %s: %w", table, err)
+		}
+		if !exists {
+			e.logger.Warn("таблица не найдена, пропускаем", zap.String("table", table))
+			continue
+		}
+
+		if err := e.exportTable(ctx, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ParquetExporter) tableColumns(ctx context.Context, table string) ([]tableColumn, error) {
+	var columns []tableColumn
+	err := e.db.SelectContext(ctx, &columns, `
+		SELECT a.attname AS name,
+		       format_type(a.atttypid, a.atttypmod) AS type,
+		       NOT a.attnotnull AS nullable
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения колонок %s: %w", table, err)
+	}
+	return columns, nil
+}
+
+// тип parquet для типа колонки Postgres; неизвестные типы пишутся строками
+func parquetNode(column tableColumn) parquet.Node {
+	var node parquet.Node
+	switch {
+	case column.Type == "integer" || column.Type == "smallint":
+		node = parquet.Int(32)
+	case column.Type == "bigint":
+		node = parquet.Int(64)
+	case column.Type == "boolean":
+		node = parquet.Leaf(parquet.BooleanType)
+	case column.Type == "double precision" || column.Type == "real":
+		node = parquet.Leaf(parquet.DoubleType)
+	case column.Type == "date":
+		node = parquet.Date()
+	case strings.HasPrefix(column.Type, "timestamp with time zone"):
+		node = parquet.Timestamp(parquet.Millisecond)
+	case strings.HasPrefix(column.Type, "timestamp"):
+		node = parquet.TimestampAdjusted(parquet.Millisecond, false)
+	default:
+		node = parquet.String()
+	}
+	if column.Nullable {
+		return parquet.Optional(node)
+	}
+	return parquet.Required(node)
+}
+
+func (e *ParquetExporter) exportTable(ctx context.Context, table string) error {
+	columns, err := e.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	has := make(map[string]bool)
+	for _, column := range columns {
+		has[column.Name] = true
+	}
+
+	// при разбиении сайт задаётся директорией и в файл не пишется
+	var fileColumns []tableColumn
+	for _, column := range columns {
+		if column.Name == "site" && e.options.Partition != PartitionNone {
+			continue
+		}
+		fileColumns = append(fileColumns, column)
+	}
+
+	yearColumn := ""
+	if e.options.Partition == PartitionSiteYear {
+		for _, candidate := range []string{"creation_date", "date"} {
+			if has[candidate] {
+				yearColumn = candidate
+				break
+			}
+		}
+	}
+
+	group := parquet.Group{}
+	for _, column := range fileColumns {
+		group[column.Name] = parquetNode(column)
+	}
+	schema := parquet.NewSchema(table, group)
+
+	// parquet.Group упорядочивает колонки по имени: находим индекс каждой колонки
+	leafIndex := make([]int, len(fileColumns))
+	for n, column := range fileColumns {
+		leaf, ok := schema.Lookup(column.Name)
+		if !ok {
+			return fmt.Errorf("колонка %s не найдена в схеме parquet", column.Name)
+		}
+		leafIndex[n] = leaf.ColumnIndex
+	}
+
+	query, args := e.tableQuery(table, fileColumns, has, yearColumn)
+	rows, err := e.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var out *parquetFile
+	defer func() {
+		if out != nil {
+			out.close()
+		}
+	}()
+
+	total := 0
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return fmt.Errorf("ошибка сканирования %s: %w", table, err)
+		}
+
+		// служебные колонки запроса: сайт и год для выбора файла
+		site, _ := values[len(fileColumns)].(string)
+		year := "__HIVE_DEFAULT_PARTITION__"
+		if y, ok := values[len(fileColumns)+1].(int64); ok {
+			year = fmt.Sprint(y)
+		}
+
+		path := e.partitionPath(table, site, year)
+		if out == nil || out.path != path {
+			if out != nil {
+				if err := out.close(); err != nil {
+					return err
+				}
+			}
+			if out, err = e.openFile(path, schema); err != nil {
+				return err
+			}
+		}
+
+		row := make(parquet.Row, len(fileColumns))
+		for n, column := range fileColumns {
+			value, err := parquetValue(column, values[n])
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", table, column.Name, err)
+			}
+			row[leafIndex[n]] = value.Level(0, definitionLevel(column, values[n]), leafIndex[n])
+		}
+		if _, err := out.writer.WriteRows([]parquet.Row{row}); err != nil {
+			return fmt.Errorf("ошибка записи parquet: %w", err)
+		}
+		out.rows++
+		total++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", table, err)
+	}
+
+	if out != nil {
+		if err := out.close(); err != nil {
+			return err
+		}
+		out = nil
+	}
+
+	e.logger.Info("таблица выгружена в parquet",
+		zap.String("table", table),
+		zap.String("partition", e.options.Partition),
+		zap.Int("rows", total))
+	return nil
+}
+
+// запрос возвращает колонки файла, затем сайт и год раздела; сортировка
+// по ключу раздела позволяет писать разделы по одному
+func (e *ParquetExporter) tableQuery(table string, columns []tableColumn, has map[string]bool, yearColumn string) (string, []interface{}) {
+	selected := make([]string, 0, len(columns)+2)
+	for _, column := range columns {
+		selected = append(selected, pq.QuoteIdentifier(column.Name))
+	}
+	selected = append(selected, "site")
+	year := "NULL::bigint"
+	if yearColumn != "" {
+		year = fmt.Sprintf("EXTRACT(YEAR FROM %s)::bigint", yearColumn)
+	}
+	selected = append(selected, year)
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selected, ", "), table)
+	var args []interface{}
+	if len(e.sites) > 0 {
+		query += " WHERE site = ANY($1)"
+		args = append(args, pq.Array(e.sites))
+	}
+
+	key := "id"
+	if !has["id"] {
+		key = "post_id"
+	}
+	switch e.options.Partition {
+	case PartitionSite:
+		query += " ORDER BY site, " + key
+	case PartitionSiteYear:
+		query += fmt.Sprintf(" ORDER BY site, %s, %s", year, key)
+	}
+	return query, args
+}
+
+func (e *ParquetExporter) partitionPath(table, site, year string) string {
+	switch e.options.Partition {
+	case PartitionSite:
+		return filepath.Join(e.outputDir, table, "site="+site, "part-0.parquet")
+	case PartitionSiteYear:
+		return filepath.Join(e.outputDir, table, "site="+site, "year="+year, "part-0.parquet")
+	}
+	return filepath.Join(e.outputDir, table+".parquet")
+}
+
+type parquetFile struct {
+	path   string
+	file   *os.File
+	writer *parquet.Writer
+	rows   int
+}
+
+func (e *ParquetExporter) openFile(path string, schema *parquet.Schema) (*parquetFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию экспорта: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать файл экспорта: %w", err)
+	}
+
+	writer := parquet.NewWriter(file, schema,
+		parquet.Compression(&parquet.Zstd),
+		parquet.MaxRowsPerRowGroup(e.options.RowGroupRows))
+	return &parquetFile{path: path, file: file, writer: writer}, nil
+}
+
+func (f *parquetFile) close() error {
+	if err := f.writer.Close(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("ошибка завершения parquet файла %s: %w", f.path, err)
+	}
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("ошибка закрытия parquet файла %s: %w", f.path, err)
+	}
+	return nil
+}
+
+func definitionLevel(column tableColumn, value interface{}) int {
+	if column.Nullable && value != nil {
+		return 1
+	}
+	return 0
+}
+
+// преобразует значение колонки в значение parquet согласно parquetNode
+func parquetValue(column tableColumn, value interface{}) (parquet.Value, error) {
+	if value == nil {
+		if !column.Nullable {
+			return parquet.Value{}, fmt.Errorf("NULL в колонке NOT NULL")
+		}
+		return parquet.NullValue(), nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if column.Type == "bigint" {
+			return parquet.Int64Value(v), nil
+		}
+		if column.Type == "integer" || column.Type == "smallint" {
+			return parquet.Int32Value(int32(v)), nil
+		}
+		return parquet.ByteArrayValue([]byte(fmt.Sprint(v))), nil
+	case float64:
+		return parquet.DoubleValue(v), nil
+	case bool:
+		return parquet.BooleanValue(v), nil
+	case time.Time:
+		if column.Type == "date" {
+			days := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+			return parquet.Int32Value(int32(days)), nil
+		}
+		// для timestamp без часового пояса пишется время на часах как UTC
+		wall := time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.UTC)
+		if strings.HasPrefix(column.Type, "timestamp with time zone") {
+			wall = v
+		}
+		return parquet.Int64Value(wall.UnixMilli()), nil
+	case []byte:
+		return parquet.ByteArrayValue(v), nil
+	case string:
+		return parquet.ByteArrayValue([]byte(v)), nil
+	}
+	return parquet.ByteArrayValue([]byte(fmt.Sprint(value))), nil
+}
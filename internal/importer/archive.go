@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"go.uber.org/zap"
+)
+
+// распаковывает архив средствами Go; если встроенный распаковщик не справился
+// (например, с неподдерживаемым методом сжатия), пробует внешний 7z
+func extract7zArchive(archivePath, outputDir string, logger *zap.Logger) error {
+	logger.Info("распаковка архива", zap.String("archive", archivePath))
+
+	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+		return fmt.Errorf("архив не найден: %s", archivePath)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("не удалось создать директорию для извлечения: %w", err)
+	}
+
+	err := extract7zNative(archivePath, outputDir)
+	if err == nil {
+		logger.Info("архив успешно распакован", zap.String("output_dir", outputDir))
+		return nil
+	}
+
+	if _, lookErr := exec.LookPath("7z"); lookErr != nil {
+		return fmt.Errorf("ошибка при распаковке архива: %w", err)
+	}
+
+	logger.Warn("встроенная распаковка не удалась, используем внешний 7z", zap.Error(err))
+	return extract7zExternal(archivePath, outputDir, logger)
+}
+
+func extract7zNative(archivePath, outputDir string) error {
+	archive, err := sevenzip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть архив: %w", err)
+	}
+	defer archive.Close()
+
+	for _, entry := range archive.File {
+		if err := extract7zEntry(entry, outputDir); err != nil {
+			return fmt.Errorf("ошибка извлечения %s: %w", entry.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func extract7zEntry(entry *sevenzip.File, outputDir string) error {
+	target := filepath.Join(outputDir, filepath.FromSlash(entry.Name))
+	if !strings.HasPrefix(target, filepath.Clean(outputDir)+string(os.PathSeparator)) {
+		return fmt.Errorf("недопустимый путь в архиве")
+	}
+
+	if entry.FileInfo().IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func extract7zExternal(archivePath, outputDir string, logger *zap.Logger) error {
+	cmd := exec.Command("7z", "x", archivePath, "-o"+outputDir, "-y")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		logger.Error("ошибка распаковки архива",
+			zap.String("output", string(output)),
+			zap.Error(err))
+		return fmt.Errorf("ошибка при распаковке архива: %w", err)
+	}
+
+	logger.Info("архив успешно распакован", zap.String("output_dir", outputDir))
+	return nil
+}
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	stateRunning = "running"
+	stateDone    = "done"
+	stateFailed  = "failed"
+
+	// размер блоков в начале и конце файла, по которым считается контрольная сумма
+	checksumBlockSize = 1 << 20
+)
+
+// контрольная точка импорта одного xml файла, соответствует строке import_state
+type fileCheckpoint struct {
+	site     string
+	file     string
+	checksum string
+	// Id последней строки, зафиксированной в базе
+	lastID int
+	status string
+}
+
+// пропускает строки, уже зафиксированные при предыдущем запуске;
+// строки в дампах Stack Exchange упорядочены по Id
+func (c *fileCheckpoint) committed(row *xml.StartElement) bool {
+	if c.lastID == 0 {
+		return false
+	}
+	for _, attr := range row.Attr {
+		if attr.Name.Local == "Id" {
+			id, err := strconv.Atoi(attr.Value)
+			return err == nil && id <= c.lastID
+		}
+	}
+	return false
+}
+
+// контрольные точки файлов, импортируемых в текущем запуске
+type checkpointRegistry struct {
+	mu    sync.Mutex
+	files map[dumpFile]*fileCheckpoint
+}
+
+func (r *checkpointRegistry) put(file dumpFile, cp *fileCheckpoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.files == nil {
+		r.files = make(map[dumpFile]*fileCheckpoint)
+	}
+	r.files[file] = cp
+}
+
+func (r *checkpointRegistry) get(file dumpFile) *fileCheckpoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.files[file]
+}
+
+// считает sha256 по размеру файла и блокам в его начале и конце:
+// полное чтение многогигабайтных дампов ради сравнения слишком дорого
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть файл: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("не удалось получить размер файла: %w", err)
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:", info.Size())
+
+	if _, err := io.CopyN(hash, file, checksumBlockSize); err != nil && err != io.EOF {
+		return "", fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	if info.Size() > 2*checksumBlockSize {
+		if _, err := file.Seek(-checksumBlockSize, io.SeekEnd); err != nil {
+			return "", fmt.Errorf("ошибка позиционирования в файле: %w", err)
+		}
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", fmt.Errorf("ошибка чтения файла: %w", err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// готовит контрольную точку файла. В режиме resume продолжает с сохранённой
+// точки, если файл не изменился; возвращает nil, если файл уже импортирован
+func (i *Importer) prepareCheckpoint(ctx context.Context, file dumpFile) (*fileCheckpoint, error) {
+	checksum, err := file.source.checksum(file.name)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &fileCheckpoint{
+		site:     file.site,
+		file:     path.Base(filepath.ToSlash(file.name)),
+		checksum: checksum,
+		status:   stateRunning,
+	}
+
+	if i.resume {
+		var saved struct {
+			FileChecksum string `db:"file_checksum"`
+			LastID       int    `db:"last_id"`
+			Status       string `db:"status"`
+		}
+		err := i.db.GetContext(ctx, &saved, `
+			SELECT file_checksum, last_id, status
+			FROM import_state
+			WHERE site = $1 AND file = $2
+		`, cp.site, cp.file)
+
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, fmt.Errorf("ошибка чтения состояния импорта: %w", err)
+		case saved.FileChecksum != checksum:
+			i.logger.Warn("файл изменился с прошлого импорта, начинаем заново",
+				zap.String("site", file.site),
+				zap.Stringer("file", file))
+		case saved.Status == stateDone:
+			return nil, nil
+		default:
+			cp.lastID = saved.LastID
+		}
+	}
+
+	if err := i.saveCheckpoint(ctx, i.db, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (i *Importer) saveCheckpoint(ctx context.Context, db execer, cp *fileCheckpoint) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO import_state (site, file, file_checksum, last_id, status, updated_at)
+		VALUES ($1, $2, $3, $4, $5, now())
+		ON CONFLICT (site, file) DO UPDATE SET
+			file_checksum = EXCLUDED.file_checksum,
+			last_id = EXCLUDED.last_id,
+			status = EXCLUDED.status,
+			updated_at = EXCLUDED.updated_at
+	`, cp.site, cp.file, cp.checksum, cp.lastID, cp.status)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния импорта: %w", err)
+	}
+	return nil
+}
+
+// меняет только статус, не трогая зафиксированный last_id
+func (i *Importer) markCheckpoint(ctx context.Context, cp *fileCheckpoint, status string) error {
+	cp.status = status
+	_, err := i.db.ExecContext(ctx, `
+		UPDATE import_state SET status = $3, updated_at = now()
+		WHERE site = $1 AND file = $2
+	`, cp.site, cp.file, status)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния импорта: %w", err)
+	}
+	return nil
+}
+
+// фиксирует Id последней строки пачки в той же транзакции, что и саму пачку
+func (i *Importer) checkpointBatch(cp *fileCheckpoint) func(tx *sql.Tx, batch [][]interface{}) error {
+	return func(tx *sql.Tx, batch [][]interface{}) error {
+		// значения пачки начинаются с site, за ним следует id
+		if id, ok := batch[len(batch)-1][1].(int); ok && id > cp.lastID {
+			cp.lastID = id
+		}
+		return i.saveCheckpoint(context.Background(), tx, cp)
+	}
+}
@@ -0,0 +1,284 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// порядок передачи строк в загрузчик при параллельном разборе
+const (
+	// строки передаются в порядке файла; нужен для контрольных точек по Id
+	parseOrdered = "ordered"
+	// диапазоны передаются по мере разбора; порядок сохраняется только внутри диапазона
+	parseUnordered = "unordered"
+)
+
+const defaultParseChunkSize = 64 << 20
+
+var rowTag = []byte("<row")
+
+// настройки параллельного разбора одного xml файла
+type parseOptions struct {
+	workers   int
+	chunkSize int64
+	ordered   bool
+}
+
+// диапазон байтов файла, начинающийся с элемента row
+type xmlChunk struct {
+	index      int
+	start, end int64
+}
+
+type parsedRow struct {
+	start xml.StartElement
+	pos   rowPosition
+}
+
+type chunkResult struct {
+	chunk xmlChunk
+	rows  []parsedRow
+	// число переводов строки в диапазоне, для сквозной нумерации строк файла
+	lines int
+	err   error
+}
+
+func isRowTagEnd(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '/', '>':
+		return true
+	}
+	return false
+}
+
+// ищет начало элемента row не раньше offset; возвращает size, если элементов больше нет.
+// В значениях атрибутов символ < экранирован, поэтому <row встречается только в начале элемента
+func nextRowStart(file io.ReaderAt, offset, size int64) (int64, error) {
+	buf := make([]byte, 64<<10)
+	for offset < size {
+		n, err := file.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("ошибка чтения файла: %w", err)
+		}
+		data := buf[:n]
+
+		for from := 0; ; {
+			k := bytes.Index(data[from:], rowTag)
+			if k < 0 {
+				break
+			}
+			at := from + k
+			// символ после <row не попал в буфер: тег будет найден в следующем окне
+			if at+len(rowTag) >= n {
+				break
+			}
+			if isRowTagEnd(data[at+len(rowTag)]) {
+				return offset + int64(at), nil
+			}
+			from = at + 1
+		}
+
+		if n < len(buf) {
+			break
+		}
+		// окна перекрываются, чтобы не пропустить тег на их границе
+		offset += int64(n - len(rowTag))
+	}
+	return size, nil
+}
+
+// делит файл на диапазоны примерно по chunkSize байт по границам элементов row;
+// также возвращает число переводов строки до первого элемента
+func splitXmlFile(file *os.File, chunkSize int64) ([]xmlChunk, int, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("не удалось получить размер файла: %w", err)
+	}
+	size := info.Size()
+
+	start, err := nextRowStart(file, 0, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	header := make([]byte, start)
+	if _, err := file.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	headerLines := bytes.Count(header, []byte{'\n'})
+
+	var chunks []xmlChunk
+	for start < size {
+		end := size
+		if start+chunkSize < size {
+			if end, err = nextRowStart(file, start+chunkSize, size); err != nil {
+				return nil, 0, err
+			}
+		}
+		chunks = append(chunks, xmlChunk{index: len(chunks), start: start, end: end})
+		start = end
+	}
+	return chunks, headerLines, nil
+}
+
+// разбирает диапазон независимо от остального файла. RawToken не проверяет
+// парность тегов, поэтому закрывающий тег корня в последнем диапазоне не мешает
+func parseXmlChunk(file io.ReaderAt, chunk xmlChunk) chunkResult {
+	result := chunkResult{chunk: chunk}
+
+	data := make([]byte, chunk.end-chunk.start)
+	if _, err := file.ReadAt(data, chunk.start); err != nil && err != io.EOF {
+		result.err = fmt.Errorf("ошибка чтения файла: %w", err)
+		return result
+	}
+	result.lines = bytes.Count(data, []byte{'\n'})
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		var pos rowPosition
+		pos.line, _ = decoder.InputPos()
+		pos.offset = chunk.start + decoder.InputOffset()
+
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.err = fmt.Errorf("ошибка чтения xml токена (смещение %d): %w", pos.offset, err)
+			break
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "row" {
+			result.rows = append(result.rows, parsedRow{start: start, pos: pos})
+		}
+	}
+	return result
+}
+
+// разбирает файл на диске диапазонами на нескольких горутинах; rowProcessor
+// вызывается из вызывающей горутины, поэтому загрузчик остаётся однопоточным.
+// Число одновременно разобранных диапазонов ограничено, чтобы не держать файл в памяти.
+// Без упорядочивания номер строки файла неизвестен и равен 0, смещение точное
+func parseXmlFileChunked(dump dumpFile, opts parseOptions, rowProcessor func(row *xml.StartElement, pos rowPosition) error, logger *zap.Logger) error {
+	file, err := os.Open(dump.name)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл: %w", err)
+	}
+	defer file.Close()
+
+	if opts.chunkSize <= 0 {
+		opts.chunkSize = defaultParseChunkSize
+	}
+	chunks, headerLines, err := splitXmlFile(file, opts.chunkSize)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("начало параллельного парсинга xml файла",
+		zap.Stringer("file", dump),
+		zap.Int("chunks", len(chunks)),
+		zap.Int("workers", opts.workers),
+		zap.Bool("ordered", opts.ordered))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan xmlChunk)
+	results := make(chan chunkResult, opts.workers)
+	inflight := make(chan struct{}, 2*opts.workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				select {
+				case results <- parseXmlChunk(file, chunk):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	// дожидаемся воркеров до закрытия файла
+	defer wg.Wait()
+	defer cancel()
+
+	go func() {
+		defer close(jobs)
+		for _, chunk := range chunks {
+			select {
+			case inflight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	rowCount := 0
+	line := headerLines
+	deliver := func(result chunkResult) error {
+		defer func() { <-inflight }()
+		for n := range result.rows {
+			row := &result.rows[n]
+			if opts.ordered {
+				row.pos.line += line
+			} else {
+				row.pos.line = 0
+			}
+			if err := rowProcessor(&row.start, row.pos); err != nil {
+				return fmt.Errorf("ошибка обработки строки: %w", err)
+			}
+
+			rowCount++
+			if rowCount%10000 == 0 {
+				logger.Info("обработано строк", zap.Int("count", rowCount))
+			}
+		}
+		line += result.lines
+		return result.err
+	}
+
+	pending := make(map[int]chunkResult)
+	next := 0
+	for result := range results {
+		if !opts.ordered {
+			if err := deliver(result); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pending[result.chunk.index] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err := deliver(ready); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("парсинг файла завершен",
+		zap.Stringer("file", dump),
+		zap.Int("total_rows", rowCount))
+	return nil
+}
@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// строки с экранированными <row и > в атрибутах, переводами строки внутри
+// элемента и самозакрывающимися и парными тегами
+const chunkedFixture = `<?xml version="1.0" encoding="utf-8"?>
+<posts>
+  <row Id="1" Body="&lt;row Id=&quot;99&quot; /&gt;" />
+  <row Id="2" Title="a > b"
+       Body="две строки" />
+  <row Id="3" Body="&lt;rows&gt;&#xA;текст" />
+  <row Id="4"></row>
+  <rowset Id="не строка" />
+  <row Id="5" Body="последняя" />
+</posts>
+`
+
+type parsedTestRow struct {
+	ID     string
+	Line   int
+	Offset int64
+}
+
+func writeFixture(t *testing.T, content string) dumpFile {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "Posts.xml")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dumpFile{site: "test", name: name, source: &dirSource{dir: filepath.Dir(name)}}
+}
+
+func collectRows(rows *[]parsedTestRow) func(*xml.StartElement, rowPosition) error {
+	return func(start *xml.StartElement, pos rowPosition) error {
+		var id string
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "Id" {
+				id = attr.Value
+			}
+		}
+		*rows = append(*rows, parsedTestRow{ID: id, Line: pos.line, Offset: pos.offset})
+		return nil
+	}
+}
+
+func TestNextRowStart(t *testing.T) {
+	file := writeFixture(t, chunkedFixture)
+	f, err := os.Open(file.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	size := int64(len(chunkedFixture))
+
+	var starts []int64
+	for n := 0; n < len(chunkedFixture); n++ {
+		if strings.HasPrefix(chunkedFixture[n:], "<row ") || strings.HasPrefix(chunkedFixture[n:], "<row>") {
+			starts = append(starts, int64(n))
+		}
+	}
+
+	for offset := int64(0); offset <= size; offset++ {
+		want := size
+		for _, start := range starts {
+			if start >= offset {
+				want = start
+				break
+			}
+		}
+		got, err := nextRowStart(f, offset, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("смещение %d: начало строки %d, ожидается %d", offset, got, want)
+		}
+	}
+}
+
+func TestParseXmlFileChunked(t *testing.T) {
+	file := writeFixture(t, chunkedFixture)
+	logger := zap.NewNop()
+
+	var want []parsedTestRow
+	if err := parseXmlFile(file, collectRows(&want), logger); err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 5 {
+		t.Fatalf("последовательный разбор: %d строк, ожидается 5", len(want))
+	}
+
+	// размер диапазона от 1 байта до всего файла: граница проходит через каждое смещение
+	for chunkSize := int64(1); chunkSize <= int64(len(chunkedFixture)); chunkSize++ {
+		for _, workers := range []int{1, 3} {
+			var got []parsedTestRow
+			opts := parseOptions{workers: workers, chunkSize: chunkSize, ordered: true}
+			if err := parseXmlFileChunked(file, opts, collectRows(&got), logger); err != nil {
+				t.Fatalf("диапазон %d, воркеров %d: %v", chunkSize, workers, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("диапазон %d, воркеров %d:\nполучено  %v\nожидается %v", chunkSize, workers, got, want)
+			}
+
+			// без упорядочивания строки те же, номер строки файла неизвестен
+			got = nil
+			opts.ordered = false
+			if err := parseXmlFileChunked(file, opts, collectRows(&got), logger); err != nil {
+				t.Fatalf("диапазон %d, воркеров %d, без порядка: %v", chunkSize, workers, err)
+			}
+			sort.Slice(got, func(a, b int) bool { return got[a].Offset < got[b].Offset })
+			for n := range got {
+				if got[n].Line != 0 || got[n].ID != want[n].ID || got[n].Offset != want[n].Offset {
+					t.Fatalf("диапазон %d, воркеров %d, без порядка:\nполучено  %v\nожидается %v", chunkSize, workers, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestParseXmlFileChunkedErrors(t *testing.T) {
+	logger := zap.NewNop()
+
+	var rows strings.Builder
+	rows.WriteString("<posts>\n")
+	for n := 0; n < 200; n++ {
+		rows.WriteString(`  <row Id="1" />` + "\n")
+	}
+	rows.WriteString("</posts>\n")
+	file := writeFixture(t, rows.String())
+
+	tests := []struct {
+		name string
+		fail int
+	}{
+		{"ошибка на первой строке", 1},
+		{"ошибка в середине файла", 100},
+		{"ошибка на последней строке", 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := errors.New("ошибка загрузчика")
+			processed := 0
+			processor := func(*xml.StartElement, rowPosition) error {
+				processed++
+				if processed == tt.fail {
+					return failure
+				}
+				return nil
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				opts := parseOptions{workers: 4, chunkSize: 64, ordered: true}
+				done <- parseXmlFileChunked(file, opts, processor, logger)
+			}()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, failure) {
+					t.Fatalf("ошибка %v, ожидается %v", err, failure)
+				}
+				if processed != tt.fail {
+					t.Errorf("обработано %d строк после ошибки на строке %d", processed, tt.fail)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("разбор не остановился после ошибки обработки строки")
+			}
+		})
+	}
+
+	t.Run("ошибка разбора диапазона", func(t *testing.T) {
+		broken := writeFixture(t, "<posts>\n  <row Id=\"1\" />\n  <row Id=\"2 />\n  <row Id=\"3\" />\n</posts>\n")
+		var got []parsedTestRow
+		opts := parseOptions{workers: 2, chunkSize: 8, ordered: true}
+		err := parseXmlFileChunked(broken, opts, collectRows(&got), logger)
+		if err == nil {
+			t.Fatal("ожидается ошибка разбора xml")
+		}
+		if len(got) != 1 || got[0].ID != "1" {
+			t.Errorf("до ошибки переданы строки %v, ожидается только Id=1", got)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/database"
+)
+
+const defaultBatchSize = 10000
+
+// накапливает строки и записывает их в хранилище пачками, по одной транзакции
+// на пачку; колонка site добавляется загрузчиком автоматически
+type bulkLoader struct {
+	store     database.Store
+	target    database.Target
+	site      string
+	batchSize int
+	batch     [][]interface{}
+	loaded    int
+	// счётчики дельта-импорта
+	inserted int
+	updated  int
+	logger   *zap.Logger
+	// вызывается внутри транзакции пачки перед её фиксацией
+	afterBatch func(tx *sql.Tx, batch [][]interface{}) error
+}
+
+func newBulkLoader(store database.Store, target database.Target, site string, batchSize int, logger *zap.Logger) *bulkLoader {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	target.Columns = append([]string{"site"}, target.Columns...)
+
+	return &bulkLoader{
+		store:     store,
+		target:    target,
+		site:      site,
+		batchSize: batchSize,
+		batch:     make([][]interface{}, 0, batchSize),
+		logger:    logger,
+	}
+}
+
+func (l *bulkLoader) Add(values ...interface{}) error {
+	if len(values)+1 != len(l.target.Columns) {
+		return fmt.Errorf("неверное количество значений для %s: ожидалось %d, получено %d",
+			l.target.Table, len(l.target.Columns)-1, len(values))
+	}
+
+	row := make([]interface{}, 0, len(values)+1)
+	row = append(row, l.site)
+	l.batch = append(l.batch, append(row, values...))
+	if len(l.batch) >= l.batchSize {
+		return l.Flush()
+	}
+	return nil
+}
+
+func (l *bulkLoader) Flush() error {
+	if len(l.batch) == 0 {
+		return nil
+	}
+
+	var afterBatch func(tx *sql.Tx) error
+	if l.afterBatch != nil {
+		afterBatch = func(tx *sql.Tx) error {
+			return l.afterBatch(tx, l.batch)
+		}
+	}
+
+	result, err := l.store.WriteBatch(context.Background(), l.target, l.batch, afterBatch)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки пачки в %s: %w", l.target.Table, err)
+	}
+	l.inserted += result.Inserted
+	l.updated += result.Updated
+
+	l.loaded += len(l.batch)
+	l.logger.Debug("пачка загружена",
+		zap.String("table", l.target.Table),
+		zap.String("site", l.site),
+		zap.Int("batch", len(l.batch)),
+		zap.Int("loaded", l.loaded))
+
+	l.batch = l.batch[:0]
+	return nil
+}
+
+func (l *bulkLoader) Loaded() int {
+	return l.loaded
+}
@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// поле модели, соответствующее xml атрибуту и колонке таблицы
+type fieldSpec struct {
+	attribute string
+	column    string
+	index     []int
+	// атрибут без omitempty обязателен для нестроковых полей
+	required bool
+}
+
+// декодирует элементы row в структуру модели по тегам xml и db
+type rowDecoder struct {
+	modelType reflect.Type
+	fields    []fieldSpec
+	byAttr    map[string]int
+}
+
+func newRowDecoder(model interface{}) *rowDecoder {
+	modelType := reflect.TypeOf(model)
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	d := &rowDecoder{
+		modelType: modelType,
+		byAttr:    make(map[string]int),
+	}
+	d.collect(modelType, nil)
+	return d
+}
+
+func (d *rowDecoder) collect(t reflect.Type, parent []int) {
+	for n := 0; n < t.NumField(); n++ {
+		field := t.Field(n)
+		index := append(append([]int{}, parent...), n)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			d.collect(field.Type, index)
+			continue
+		}
+
+		column := field.Tag.Get("db")
+		parts := strings.Split(field.Tag.Get("xml"), ",")
+		if column == "" || len(parts) < 2 || parts[1] != "attr" {
+			continue
+		}
+
+		omitempty := false
+		for _, option := range parts[2:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		kind := field.Type.Kind()
+
+		d.byAttr[parts[0]] = len(d.fields)
+		d.fields = append(d.fields, fieldSpec{
+			attribute: parts[0],
+			column:    column,
+			index:     index,
+			required:  !omitempty && kind != reflect.Ptr && kind != reflect.String,
+		})
+	}
+}
+
+func (d *rowDecoder) columns() []string {
+	columns := make([]string, len(d.fields))
+	for n, field := range d.fields {
+		columns[n] = field.column
+	}
+	return columns
+}
+
+// декодирует строку и возвращает значения колонок в порядке columns();
+// ошибки всех атрибутов собираются в *rowError
+func (d *rowDecoder) decode(start *xml.StartElement) ([]interface{}, error) {
+	row := reflect.New(d.modelType).Elem()
+	seen := make([]bool, len(d.fields))
+	var rowErr rowError
+
+	for _, attr := range start.Attr {
+		n, ok := d.byAttr[attr.Name.Local]
+		if !ok || attr.Value == "" {
+			continue
+		}
+		seen[n] = true
+		if err := setField(row.FieldByIndex(d.fields[n].index), attr); err != nil {
+			rowErr.fields = append(rowErr.fields, fieldError{
+				attribute: attr.Name.Local,
+				value:     attr.Value,
+				err:       err,
+			})
+		}
+	}
+
+	for n, field := range d.fields {
+		if field.required && !seen[n] {
+			rowErr.fields = append(rowErr.fields, fieldError{
+				attribute: field.attribute,
+				err:       fmt.Errorf("обязательный атрибут отсутствует"),
+			})
+		}
+	}
+
+	values := make([]interface{}, len(d.fields))
+	for n, field := range d.fields {
+		value := row.FieldByIndex(field.index)
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			values[n] = nil
+			continue
+		}
+		values[n] = value.Interface()
+	}
+
+	if len(rowErr.fields) > 0 {
+		return values, &rowErr
+	}
+	return values, nil
+}
+
+var attrUnmarshalerType = reflect.TypeOf((*xml.UnmarshalerAttr)(nil)).Elem()
+
+func setField(field reflect.Value, attr xml.Attr) error {
+	if field.Kind() == reflect.Ptr {
+		value := reflect.New(field.Type().Elem())
+		if err := setField(value.Elem(), attr); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+
+	if field.Addr().Type().Implements(attrUnmarshalerType) {
+		return field.Addr().Interface().(xml.UnmarshalerAttr).UnmarshalXMLAttr(attr)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(attr.Value)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(attr.Value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(attr.Value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("неподдерживаемый тип поля %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// дельта-импорт удаляет строки, пропавшие из дампа, поэтому ограничения
+// внешнего ключа снимаются заранее; add_constraints.sql вернёт их перед анализом
+func (i *Importer) prepareDelta(ctx context.Context) error {
+	i.logger.Info("дельта-импорт: отключение ограничений внешнего ключа",
+		zap.String("dump_date", i.dumpDate))
+
+	_, err := i.db.ExecContext(ctx, `
+		DO $$
+		DECLARE r record;
+		BEGIN
+			FOR r IN
+				SELECT conrelid::regclass AS tbl, conname
+				FROM pg_constraint
+				WHERE contype = 'f'
+				AND connamespace = current_schema()::regnamespace
+			LOOP
+				EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', r.tbl, r.conname);
+			END LOOP;
+		END $$;
+	`)
+	if err != nil {
+		return fmt.Errorf("ошибка отключения ограничений внешнего ключа: %w", err)
+	}
+	return nil
+}
+
+// очищает список увиденных id сущности перед загрузкой файла с начала
+func (i *Importer) resetDeltaSeen(ctx context.Context, site, table string) error {
+	_, err := i.db.ExecContext(ctx,
+		"DELETE FROM delta_seen WHERE site = $1 AND entity = $2", site, table)
+	if err != nil {
+		return fmt.Errorf("ошибка очистки delta_seen: %w", err)
+	}
+	return nil
+}
+
+// удаляет строки, которых нет в новом дампе, сохраняя их id в deleted_rows,
+// и записывает итоги изменений сущности в import_changes
+func (i *Importer) finishDelta(ctx context.Context, loader *bulkLoader) error {
+	site, table := loader.site, loader.target.Table
+
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		WITH gone AS (
+			DELETE FROM %s t
+			WHERE t.site = $1
+			AND NOT EXISTS (
+				SELECT 1 FROM delta_seen s
+				WHERE s.site = t.site AND s.entity = $2 AND s.id = t.id
+			)
+			RETURNING t.id
+		)
+		INSERT INTO deleted_rows (site, entity, id, dump_date)
+		SELECT $1, $2, id, $3 FROM gone
+	`, table), site, table, i.dumpDate)
+	if err != nil {
+		return fmt.Errorf("ошибка поиска удалённых строк: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO import_changes (site, entity, dump_date, inserted, updated, deleted)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, site, table, i.dumpDate, loader.inserted, loader.updated, deleted)
+	if err != nil {
+		return fmt.Errorf("ошибка записи итогов изменений: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM delta_seen WHERE site = $1 AND entity = $2", site, table)
+	if err != nil {
+		return fmt.Errorf("ошибка очистки delta_seen: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+
+	i.logger.Info("итоги дельта-импорта",
+		zap.String("site", site),
+		zap.String("entity", table),
+		zap.String("dump_date", i.dumpDate),
+		zap.Int("inserted", loader.inserted),
+		zap.Int("updated", loader.updated),
+		zap.Int64("deleted", deleted))
+	return nil
+}
@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"stackexchange-data-analysis/internal/database"
+	"stackexchange-data-analysis/internal/models"
+)
+
+// описание сущности дампа: xml файл, модель, таблица и действие при конфликте.
+// Колонки таблицы берутся из тегов db модели, поэтому новая колонка
+// добавляется только в модель и схему
+type entity struct {
+	// тип файла дампа, например Posts для Posts.xml
+	name           string
+	table          string
+	decoder        *rowDecoder
+	conflictAction string
+	// выполняются до и после загрузки файла сущности
+	before func(i *Importer, ctx context.Context, site string) error
+	after  func(i *Importer, ctx context.Context, site string) error
+}
+
+var entities = []*entity{
+	{
+		name:    "Users",
+		table:   "users",
+		decoder: newRowDecoder(models.User{}),
+		conflictAction: `DO UPDATE SET
+			reputation = EXCLUDED.reputation,
+			display_name = EXCLUDED.display_name`,
+	},
+	{
+		name:    "Posts",
+		table:   "posts",
+		decoder: newRowDecoder(models.Post{}),
+		conflictAction: `DO UPDATE SET
+			score = EXCLUDED.score,
+			view_count = EXCLUDED.view_count,
+			answer_count = EXCLUDED.answer_count`,
+		before: (*Importer).dropPostsConstraints,
+		after:  (*Importer).cleanupPosts,
+	},
+	{
+		name:           "Comments",
+		table:          "comments",
+		decoder:        newRowDecoder(models.Comment{}),
+		conflictAction: "DO NOTHING",
+	},
+	{
+		name:           "Badges",
+		table:          "badges",
+		decoder:        newRowDecoder(models.Badge{}),
+		conflictAction: "DO NOTHING",
+	},
+	{
+		name:           "PostHistory",
+		table:          "post_history",
+		decoder:        newRowDecoder(models.PostHistory{}),
+		conflictAction: "DO NOTHING",
+	},
+	{
+		name:           "PostLinks",
+		table:          "post_links",
+		decoder:        newRowDecoder(models.PostLink{}),
+		conflictAction: "DO NOTHING",
+	},
+	{
+		name:           "Tags",
+		table:          "tags",
+		decoder:        newRowDecoder(models.Tag{}),
+		conflictAction: "DO NOTHING",
+	},
+	{
+		name:           "Votes",
+		table:          "votes",
+		decoder:        newRowDecoder(models.Vote{}),
+		conflictAction: "DO NOTHING",
+	},
+}
+
+func entityByName(name string) (*entity, error) {
+	for _, e := range entities {
+		if e.name == name {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("неизвестная сущность %s", name)
+}
+
+func (e *entity) target() database.Target {
+	return database.Target{
+		Table:          e.table,
+		Columns:        e.decoder.columns(),
+		ConflictKey:    "site, id",
+		ConflictAction: e.conflictAction,
+	}
+}
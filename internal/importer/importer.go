@@ -1,291 +1,334 @@
 package importer
 
 import (
-	"database/sql"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/anonymize"
 	"stackexchange-data-analysis/internal/config"
+	"stackexchange-data-analysis/internal/database"
 )
 
 type Importer struct {
+	store database.Store
+	// соединение хранилища для служебных таблиц импорта
 	db          *sqlx.DB
 	dataDir     string
 	logger      *zap.Logger
 	concurrency int
-	dbConfig    *config.DatabaseConfig
+	batchSize   int
+	sites       []string
+	resume      bool
+	// читать xml файлы прямо из 7z архивов, не распаковывая их на диск
+	streamArchives bool
+	dbConfig       *config.DatabaseConfig
+	summary        *importSummary
+	checkpoints    *checkpointRegistry
+	// политика обработки некорректных строк: lenient, reject или strict
+	validation    string
+	rejectLogPath string
+	rejects       rejectLog
+	// дельта-импорт нового дампа поверх сохранённых данных
+	delta    bool
+	dumpDate string
+	// хранить версии строк по снимкам дампов (таблицы *_versions)
+	snapshot bool
+	// dump_id загружаемого дампа по сайтам; заполняется до запуска воркеров
+	dumpIDs map[string]int
+	// параллельный разбор больших xml файлов
+	parse parseOptions
+	// выборочный импорт; nil означает импорт всего дампа
+	subset *subsetFilter
+	// анонимизация персональных данных при загрузке; policy загружается в ImportAll
+	anonymize       bool
+	anonymizePolicy string
+	policy          *anonymize.Policy
 }
 
-func NewImporter(db *sqlx.DB, cfg *config.Config, logger *zap.Logger) *Importer {
+func NewImporter(store database.Store, cfg *config.Config, logger *zap.Logger) *Importer {
 	return &Importer{
-		db:          db,
-		dataDir:     cfg.DataDir,
-		logger:      logger,
-		concurrency: cfg.Concurrency,
-		dbConfig:    &cfg.Database,
+		store:          store,
+		db:             store.DB(),
+		dataDir:        cfg.DataDir,
+		logger:         logger,
+		concurrency:    cfg.Concurrency,
+		batchSize:      cfg.BatchSize,
+		sites:          cfg.Sites,
+		resume:         cfg.Resume,
+		streamArchives: cfg.StreamArchives,
+		dbConfig:       &cfg.Database,
+		summary:        &importSummary{},
+		checkpoints:    &checkpointRegistry{},
+		validation:     cfg.Validation,
+		rejectLogPath:  cfg.RejectLog,
+		delta:          cfg.Delta,
+		dumpDate:       cfg.DumpDate,
+		snapshot:       cfg.Snapshot,
+		dumpIDs:        make(map[string]int),
+		parse: parseOptions{
+			workers:   cfg.ParseWorkers,
+			chunkSize: int64(cfg.ParseChunkMB) << 20,
+			ordered:   cfg.ParseOrder != parseUnordered,
+		},
+		subset:          newSubsetFilter(cfg.Subset),
+		anonymize:       cfg.Anonymize,
+		anonymizePolicy: cfg.AnonymizePolicy,
 	}
 }
 
 func (i *Importer) ImportAll() error {
-	var err error
+	// наборы id выборки живут только в памяти текущего запуска
+	if i.subset != nil && i.resume {
+		return fmt.Errorf("выборочный импорт нельзя продолжить с контрольной точки, запустите его заново")
+	}
+	// строки вне выборки не попадают в delta_seen, и дельта-импорт счёл бы их удалёнными
+	if i.subset != nil && i.delta {
+		return fmt.Errorf("выборочный импорт несовместим с дельта-импортом: строки вне выборки были бы удалены")
+	}
 
-	mainArchive := filepath.Join(i.dataDir, "dba.stackexchange.com.7z")
-	mainExtractDir := filepath.Join(i.dataDir, "dba.stackexchange.com")
-	metaArchive := filepath.Join(i.dataDir, "dba.meta.stackexchange.com.7z")
-	metaExtractDir := filepath.Join(i.dataDir, "dba.meta.stackexchange.com")
+	// дельта-импорт и снимки построены на возможностях Postgres
+	if (i.delta || i.snapshot) && i.store.Driver() != database.DriverPostgres {
+		return fmt.Errorf("дельта-импорт и снимки поддерживаются только в Postgres")
+	}
 
-	if err = extract7zArchive(mainArchive, mainExtractDir, i.logger); err != nil {
-		return err
+	// снимок сравнивает версии с основными таблицами, которые отражают новый
+	// дамп целиком только после дельта-импорта
+	if i.snapshot && !i.delta {
+		return fmt.Errorf("снимок записывается только при дельта-импорте, добавьте --delta")
 	}
 
-	if err = extract7zArchive(metaArchive, metaExtractDir, i.logger); err != nil {
+	if err := i.openRejectLog(); err != nil {
 		return err
 	}
+	defer i.rejects.Close()
 
-	if err = i.importSite(mainExtractDir); err != nil {
-		return err
+	if i.anonymize {
+		policy, err := anonymize.LoadPolicy(i.anonymizePolicy)
+		if err != nil {
+			return err
+		}
+		if policy.RandomSalt() {
+			i.logger.Warn("соль анонимизации не задана: псевдонимы будут другими при следующем запуске")
+		}
+		i.policy = policy
 	}
 
-	if err = i.importSite(metaExtractDir); err != nil {
+	sources, err := discoverSites(i.dataDir, i.sites)
+	if err != nil {
 		return err
 	}
+	if len(sources) == 0 {
+		return fmt.Errorf("в директории %s не найдено ни одного сайта для импорта", i.dataDir)
+	}
 
-	if err = i.refreshMaterializedViews(); err != nil {
-		return err
+	if i.delta {
+		if err := i.prepareDelta(context.Background()); err != nil {
+			return err
+		}
 	}
 
-	return nil
-}
+	var failed []string
+	for _, source := range sources {
+		started := time.Now()
+		err := i.importSource(source)
+		i.summary.finish(source.site, time.Since(started), err)
+		if err != nil {
+			i.logger.Error("ошибка импорта сайта",
+				zap.String("site", source.site),
+				zap.Error(err))
+			failed = append(failed, source.site)
+		}
+	}
 
-func (i *Importer) refreshMaterializedViews() error {
-	i.logger.Info("обновление материализованных представлений")
+	i.summary.log(i.logger)
 
-	var exists bool
-	err := i.db.Get(&exists, `
-        SELECT EXISTS (
-            SELECT 1 
-            FROM pg_matviews 
-            WHERE matviewname = 'post_tags'
-        )
-    `)
-
-	if err != nil {
-		return fmt.Errorf("ошибка проверки существования представления: %w", err)
+	if len(failed) > 0 {
+		return fmt.Errorf("не удалось импортировать сайты: %s", strings.Join(failed, ", "))
 	}
 
-	if exists {
-		_, err = i.db.Exec("REFRESH MATERIALIZED VIEW post_tags")
-		if err != nil {
-			return fmt.Errorf("ошибка обновления материализованного представления: %w", err)
-		}
-		i.logger.Info("материализованное представление post_tags успешно обновлено")
-	} else {
-		i.logger.Warn("представление post_tags не найдено, обновление пропущено")
+	if err = i.store.RefreshDerived(context.Background()); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (i *Importer) importSite(siteDir string) error {
-	i.logger.Info("начало импорта данных сайта", zap.String("dir", siteDir))
-
-	importOrder := []struct {
-		entityType string
-		importFunc func(string) error
-	}{
-		{"Users", i.importUsers},
-		{"Posts", i.importPosts},
-		{"Comments", i.importComments},
-		{"Badges", i.importBadges},
-		{"PostHistory", i.importPostHistory},
-		{"PostLinks", i.importPostLinks},
-		{"Tags", i.importTags},
-		{"Votes", i.importVotes},
-	}
-
-	for _, item := range importOrder {
-		xmlFile, err := findXmlFile(siteDir, item.entityType)
+// импортирует сайт из распакованной директории; архив либо читается потоком
+// (stream_archives), либо распаковывается на диск, если xml файлов ещё нет
+func (i *Importer) importSource(source siteSource) error {
+	var src dumpSource
+	if source.hasArchive() && i.streamArchives {
+		archive, err := openArchiveSource(source.archive)
 		if err != nil {
-			i.logger.Warn("файл не найден, пропускаем",
-				zap.String("entity", item.entityType),
-				zap.Error(err))
-			continue
+			return err
+		}
+		src = archive
+	} else {
+		if _, err := findXmlFile(source.extractDir, ""); err != nil {
+			if !source.hasArchive() {
+				return err
+			}
+			if err := extract7zArchive(source.archive, source.extractDir, i.logger); err != nil {
+				return err
+			}
 		}
+		src = &dirSource{dir: source.extractDir}
+	}
+	defer src.Close()
 
-		if err := item.importFunc(xmlFile); err != nil {
-			return fmt.Errorf("ошибка импорта %s: %w", item.entityType, err)
+	if i.snapshot {
+		dumpID, err := i.registerDump(context.Background(), source.site)
+		if err != nil {
+			return err
 		}
+		i.dumpIDs[source.site] = dumpID
 	}
 
-	i.logger.Info("импорт данных сайта завершен", zap.String("dir", siteDir))
-	return nil
+	return i.importSite(source.site, src)
 }
 
-func (i *Importer) importUsers(xmlFile string) error {
-	i.logger.Info("импорт пользователей", zap.String("file", xmlFile))
-
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO users (
-			id, reputation, display_name, about_me, website_url, location,
-			creation_date, last_access_date, views, up_votes, down_votes, account_id
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-		ON CONFLICT (id) DO UPDATE SET
-			reputation = EXCLUDED.reputation,
-			display_name = EXCLUDED.display_name
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
+func (i *Importer) openRejectLog() error {
+	if i.validation == "" {
+		i.validation = policyLenient
+	}
+	if !validPolicy(i.validation) {
+		return fmt.Errorf("неизвестная политика валидации %q, используйте: lenient, reject или strict", i.validation)
 	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
-
-		id, _ := strconv.Atoi(attrs["Id"])
-		reputation, _ := strconv.Atoi(attrs["Reputation"])
-		views, _ := strconv.Atoi(attrs["Views"])
-		upVotes, _ := strconv.Atoi(attrs["UpVotes"])
-		downVotes, _ := strconv.Atoi(attrs["DownVotes"])
-		accountId, _ := strconv.Atoi(attrs["AccountId"])
 
-		creationDate, _ := parseTime(attrs["CreationDate"])
-		lastAccessDate, _ := parseTime(attrs["LastAccessDate"])
+	if i.rejectLogPath == "" {
+		i.rejects = &tableRejectLog{db: i.db}
+		return nil
+	}
 
-		_, err := insertStmt.Exec(
-			id, reputation, attrs["DisplayName"], attrs["AboutMe"],
-			attrs["WebsiteUrl"], attrs["Location"], creationDate, lastAccessDate,
-			views, upVotes, downVotes, accountId,
-		)
+	rejects, err := newFileRejectLog(i.rejectLogPath)
+	if err != nil {
 		return err
 	}
-
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
+	i.rejects = rejects
+	return nil
 }
 
-func (i *Importer) importPosts(xmlFile string) error {
-	i.logger.Info("импорт постов", zap.String("file", xmlFile))
+func (i *Importer) importSite(site string, src dumpSource) error {
+	i.logger.Info("начало импорта данных сайта", zap.String("site", site))
 
-	_, err := i.db.Exec(`
-        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_accepted_answer_id;
-        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_parent_id;
-        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_owner_user_id;
-        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_last_editor_user_id;
-    `)
-	if err != nil {
-		return fmt.Errorf("ошибка отключения ограничений внешнего ключа: %w", err)
+	// Users и Posts загружаются последовательно: очистка posts ссылается на users,
+	// остальные сущности независимы друг от друга и загружаются параллельно
+	stages := [][]string{
+		{"Users"},
+		{"Posts"},
+		{"Comments", "Badges", "PostHistory", "PostLinks", "Tags", "Votes"},
 	}
 
-	insertStmt, err := i.db.Prepare(`
-        INSERT INTO posts (
-            id, post_type_id, accepted_answer_id, creation_date, score, view_count,
-            body, owner_user_id, last_editor_user_id, last_edit_date, last_activity_date,
-            title, tags, answer_count, comment_count, favorite_count, closed_date,
-            parent_id, community_owned_date
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
-        ON CONFLICT (id) DO UPDATE SET
-            score = EXCLUDED.score,
-            view_count = EXCLUDED.view_count,
-            answer_count = EXCLUDED.answer_count
-    `)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
+	ctx := context.Background()
+	if i.subset != nil {
+		stages = subsetStages
+		i.subset.reset()
+		if err := i.selectSubsetRoots(site, src); err != nil {
+			return err
+		}
 	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
-
-		id, _ := strconv.Atoi(attrs["Id"])
-		postTypeId, _ := strconv.Atoi(attrs["PostTypeId"])
 
-		var acceptedAnswerId sql.NullInt64
-		if val, ok := attrs["AcceptedAnswerId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			acceptedAnswerId = sql.NullInt64{Valid: true, Int64: id}
+	for _, names := range stages {
+		stage := make(importStage, 0, len(names))
+		for _, name := range names {
+			e, err := entityByName(name)
+			if err != nil {
+				return err
+			}
+			stage = append(stage, e)
 		}
 
-		score, _ := strconv.Atoi(attrs["Score"])
-
-		var viewCount sql.NullInt64
-		if val, ok := attrs["ViewCount"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			viewCount = sql.NullInt64{Valid: true, Int64: id}
+		if err := i.runStage(ctx, site, src, stage); err != nil {
+			return err
 		}
+	}
 
-		var ownerUserId sql.NullInt64
-		if val, ok := attrs["OwnerUserId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			ownerUserId = sql.NullInt64{Valid: true, Int64: id}
+	if i.subset != nil {
+		if err := i.runDeferredHooks(ctx, site); err != nil {
+			return err
 		}
+		i.subset.log(i.logger, site)
+	}
 
-		var lastEditorUserId sql.NullInt64
-		if val, ok := attrs["LastEditorUserId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			lastEditorUserId = sql.NullInt64{Valid: true, Int64: id}
-		}
+	i.logger.Info("импорт данных сайта завершен", zap.String("site", site))
+	return nil
+}
 
-		answerCount, _ := strconv.Atoi(attrs["AnswerCount"])
-		commentCount, _ := strconv.Atoi(attrs["CommentCount"])
-		favoriteCount, _ := strconv.Atoi(attrs["FavoriteCount"])
+// загружает xml файл сущности согласно её описанию в реестре entities
+func (i *Importer) importEntity(ctx context.Context, file dumpFile, e *entity) error {
+	i.logger.Info("импорт сущности",
+		zap.String("entity", e.name),
+		zap.Stringer("file", file))
 
-		var parentId sql.NullInt64
-		if val, ok := attrs["ParentId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			parentId = sql.NullInt64{Valid: true, Int64: id}
+	if e.before != nil {
+		if err := e.before(i, ctx, file.site); err != nil {
+			return err
 		}
+	}
 
-		creationDate, _ := parseTime(attrs["CreationDate"])
-		lastEditDate, _ := parseTimeNullable(attrs["LastEditDate"])
-		lastActivityDate, _ := parseTimeNullable(attrs["LastActivityDate"])
-		closedDate, _ := parseTimeNullable(attrs["ClosedDate"])
-		communityOwnedDate, _ := parseTimeNullable(attrs["CommunityOwnedDate"])
-
-		_, err := insertStmt.Exec(
-			id, postTypeId, acceptedAnswerId, creationDate, score, viewCount,
-			attrs["Body"], ownerUserId, lastEditorUserId, lastEditDate, lastActivityDate,
-			attrs["Title"], attrs["Tags"], answerCount, commentCount, favoriteCount,
-			closedDate, parentId, communityOwnedDate,
-		)
+	loader := i.newLoader(file.site, e.target())
+	if err := i.load(ctx, file, loader, e.decoder); err != nil {
 		return err
 	}
 
-	err = parseXmlFile(xmlFile, rowProcessor, i.logger)
+	if e.after != nil && i.subset == nil {
+		if err := e.after(i, ctx, file.site); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// в схеме SQLite внешних ключей нет
+func (i *Importer) dropPostsConstraints(ctx context.Context, site string) error {
+	if i.store.Driver() != database.DriverPostgres {
+		return nil
+	}
+
+	_, err := i.db.ExecContext(ctx, `
+        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_accepted_answer_id;
+        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_parent_id;
+        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_owner_user_id;
+        ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_last_editor_user_id;
+    `)
 	if err != nil {
-		return err
+		return fmt.Errorf("ошибка отключения ограничений внешнего ключа: %w", err)
 	}
+	return nil
+}
 
+func (i *Importer) cleanupPosts(ctx context.Context, site string) error {
 	i.logger.Info("очистка несогласованных данных в posts")
-	_, err = i.db.Exec(`
+	_, err := i.db.ExecContext(ctx, `
         -- Очистка несуществующих accepted_answer_id
         UPDATE posts 
         SET accepted_answer_id = NULL 
         WHERE accepted_answer_id IS NOT NULL 
-        AND NOT EXISTS (SELECT 1 FROM posts p2 WHERE p2.id = posts.accepted_answer_id);
+        AND NOT EXISTS (SELECT 1 FROM posts p2 WHERE p2.site = posts.site AND p2.id = posts.accepted_answer_id);
         
         -- Очистка несуществующих parent_id
         UPDATE posts 
         SET parent_id = NULL 
         WHERE parent_id IS NOT NULL 
-        AND NOT EXISTS (SELECT 1 FROM posts p2 WHERE p2.id = posts.parent_id);
+        AND NOT EXISTS (SELECT 1 FROM posts p2 WHERE p2.site = posts.site AND p2.id = posts.parent_id);
         
         -- Очистка несуществующих owner_user_id
         UPDATE posts 
         SET owner_user_id = NULL 
         WHERE owner_user_id IS NOT NULL 
-        AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = posts.owner_user_id);
+        AND NOT EXISTS (SELECT 1 FROM users u WHERE u.site = posts.site AND u.id = posts.owner_user_id);
         
         -- Очистка несуществующих last_editor_user_id
         UPDATE posts 
         SET last_editor_user_id = NULL 
         WHERE last_editor_user_id IS NOT NULL 
-        AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = posts.last_editor_user_id);
+        AND NOT EXISTS (SELECT 1 FROM users u WHERE u.site = posts.site AND u.id = posts.last_editor_user_id);
     `)
 	if err != nil {
 		return fmt.Errorf("ошибка очистки несогласованных данных: %w", err)
@@ -293,254 +336,135 @@ func (i *Importer) importPosts(xmlFile string) error {
 
 	// НЕ добавляем ограничения внешнего ключа автоматически
 	// Они будут добавлены позже через отдельный скрипт add_constraints.sql
-	i.logger.Info("импорт постов завершен успешно")
+	i.logger.Info("импорт постов завершен успешно", zap.String("site", site))
 	return nil
 }
 
-func (i *Importer) importComments(xmlFile string) error {
-	i.logger.Info("импорт комментариев", zap.String("file", xmlFile))
-
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO comments (id, post_id, user_id, score, text, creation_date)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) DO NOTHING
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
-	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
-
-		id, _ := strconv.Atoi(attrs["Id"])
-		postId, _ := strconv.Atoi(attrs["PostId"])
-
-		var userId sql.NullInt64
-		if val, ok := attrs["UserId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			userId = sql.NullInt64{Valid: true, Int64: id}
-		}
-
-		score, _ := strconv.Atoi(attrs["Score"])
-		creationDate, _ := parseTime(attrs["CreationDate"])
-
-		_, err := insertStmt.Exec(
-			id, postId, userId, score, attrs["Text"], creationDate,
-		)
-		return err
-	}
-
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
+func (i *Importer) newLoader(site string, target database.Target) *bulkLoader {
+	return newBulkLoader(i.store, target, site, i.batchSize, i.logger)
 }
 
-func (i *Importer) importBadges(xmlFile string) error {
-	i.logger.Info("импорт знаков отличия", zap.String("file", xmlFile))
-
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO badges (id, user_id, name, date, class, tag_based)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) DO NOTHING
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
-	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
-
-		id, _ := strconv.Atoi(attrs["Id"])
-		userId, _ := strconv.Atoi(attrs["UserId"])
-		class, _ := strconv.Atoi(attrs["Class"])
-
-		var tagBased bool
-		if val, ok := attrs["TagBased"]; ok {
-			tagBased = strings.ToLower(val) == "true"
+// разбирает xml файл, передавая значения строк в загрузчик, и дозагружает остаток пачки;
+// строки с ошибками разбора обрабатываются согласно политике валидации
+func (i *Importer) load(ctx context.Context, file dumpFile, loader *bulkLoader, decoder *rowDecoder) error {
+	cp := i.checkpoints.get(file)
+	if cp != nil {
+		// без упорядочивания Id последней строки пачки не означает, что загружены
+		// все строки с меньшим Id, поэтому контрольная точка не продвигается
+		if i.parallelParse(file) && !i.parse.ordered {
+			i.logger.Info("контрольные точки строк отключены: строки разбираются без упорядочивания",
+				zap.Stringer("file", file))
+		} else {
+			loader.afterBatch = i.checkpointBatch(cp)
+		}
+		if cp.lastID > 0 {
+			i.logger.Info("продолжение импорта с контрольной точки",
+				zap.Stringer("file", file),
+				zap.Int("last_id", cp.lastID))
 		}
-
-		date, _ := parseTime(attrs["Date"])
-
-		_, err := insertStmt.Exec(
-			id, userId, attrs["Name"], date, class, tagBased,
-		)
-		return err
-	}
-
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
-}
-
-func (i *Importer) importPostHistory(xmlFile string) error {
-	i.logger.Info("импорт истории постов", zap.String("file", xmlFile))
-
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO post_history (
-			id, post_id, user_id, post_history_type_id, revision_guid,
-			creation_date, text, comment
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (id) DO NOTHING
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
 	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
-
-		id, _ := strconv.Atoi(attrs["Id"])
-		postId, _ := strconv.Atoi(attrs["PostId"])
 
-		var userId sql.NullInt64
-		if val, ok := attrs["UserId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			userId = sql.NullInt64{Valid: true, Int64: id}
+	if i.delta {
+		loader.target.Delta = true
+		if cp == nil || cp.lastID == 0 {
+			if err := i.resetDeltaSeen(ctx, loader.site, loader.target.Table); err != nil {
+				return err
+			}
 		}
-
-		postHistoryTypeId, _ := strconv.Atoi(attrs["PostHistoryTypeId"])
-		creationDate, _ := parseTime(attrs["CreationDate"])
-
-		_, err := insertStmt.Exec(
-			id, postId, userId, postHistoryTypeId, attrs["RevisionGUID"],
-			creationDate, attrs["Text"], attrs["Comment"],
-		)
-		return err
 	}
 
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
-}
-
-func (i *Importer) importPostLinks(xmlFile string) error {
-	i.logger.Info("импорт связей между постами", zap.String("file", xmlFile))
+	columns := decoder.columns()
+	processor := func(start *xml.StartElement, pos rowPosition) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if cp != nil && cp.committed(start) {
+			return nil
+		}
+		if i.subset != nil && !i.subset.accept(loader.target.Table, start) {
+			return nil
+		}
 
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO post_links (id, creation_date, post_id, related_post_id, link_type_id)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (id) DO NOTHING
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
+		values, err := decoder.decode(start)
+		if err != nil {
+			var rowErr *rowError
+			if !errors.As(err, &rowErr) {
+				return err
+			}
+			if err := i.handleInvalidRow(ctx, file, loader.target.Table, pos, rowErr); err != nil {
+				return err
+			}
+			if i.validation != policyLenient {
+				return nil
+			}
+		}
+		if i.policy != nil {
+			i.policy.Apply(loader.target.Table, columns, values)
+		}
+		return loader.Add(values...)
 	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
 
-		id, _ := strconv.Atoi(attrs["Id"])
-		postId, _ := strconv.Atoi(attrs["PostId"])
-		relatedPostId, _ := strconv.Atoi(attrs["RelatedPostId"])
-		linkTypeId, _ := strconv.Atoi(attrs["LinkTypeId"])
-		creationDate, _ := parseTime(attrs["CreationDate"])
-
-		_, err := insertStmt.Exec(
-			id, creationDate, postId, relatedPostId, linkTypeId,
-		)
+	if err := i.parseFile(file, processor); err != nil {
 		return err
 	}
 
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
-}
-
-func (i *Importer) importTags(xmlFile string) error {
-	i.logger.Info("импорт тегов", zap.String("file", xmlFile))
-
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO tags (id, tag_name, count, excerpt_post_id, wiki_post_id)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (id) DO NOTHING
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
+	if err := loader.Flush(); err != nil {
+		return err
 	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
+	i.summary.addRows(loader.site, loader.target.Table, loader.Loaded())
 
-		id, _ := strconv.Atoi(attrs["Id"])
-		count, _ := strconv.Atoi(attrs["Count"])
-
-		var excerptPostId sql.NullInt64
-		if val, ok := attrs["ExcerptPostId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			excerptPostId = sql.NullInt64{Valid: true, Int64: id}
+	if i.delta {
+		if err := i.finishDelta(ctx, loader); err != nil {
+			return err
 		}
+	}
 
-		var wikiPostId sql.NullInt64
-		if val, ok := attrs["WikiPostId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			wikiPostId = sql.NullInt64{Valid: true, Int64: id}
+	if i.snapshot {
+		if err := i.recordSnapshot(ctx, loader.target, loader.site); err != nil {
+			return err
 		}
-
-		_, err := insertStmt.Exec(
-			id, attrs["TagName"], count, excerptPostId, wikiPostId,
-		)
-		return err
 	}
 
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
+	i.logger.Info("данные загружены",
+		zap.String("table", loader.target.Table),
+		zap.String("site", loader.site),
+		zap.Int("rows", loader.Loaded()))
+	return nil
 }
 
-func parseTime(timeStr string) (time.Time, error) {
-	if timeStr == "" {
-		return time.Time{}, fmt.Errorf("пустая строка времени")
+func (i *Importer) parseFile(file dumpFile, rowProcessor func(row *xml.StartElement, pos rowPosition) error) error {
+	if i.parallelParse(file) {
+		return parseXmlFileChunked(file, i.parse, rowProcessor, i.logger)
 	}
-	return time.Parse("2006-01-02T15:04:05.000", timeStr)
+	return parseXmlFile(file, rowProcessor, i.logger)
 }
 
-func parseTimeNullable(timeStr string) (sql.NullTime, error) {
-	if timeStr == "" {
-		return sql.NullTime{Valid: false}, nil
-	}
-
-	t, err := time.Parse("2006-01-02T15:04:05.000", timeStr)
-	if err != nil {
-		return sql.NullTime{Valid: false}, err
-	}
-
-	return sql.NullTime{Valid: true, Time: t}, nil
+// параллельно разбираются только файлы на диске: запись архива читается потоком
+func (i *Importer) parallelParse(file dumpFile) bool {
+	_, onDisk := file.source.(*dirSource)
+	return onDisk && i.parse.workers > 1
 }
 
-func (i *Importer) importVotes(xmlFile string) error {
-	i.logger.Info("импорт голосов", zap.String("file", xmlFile))
-
-	insertStmt, err := i.db.Prepare(`
-		INSERT INTO votes (id, post_id, vote_type_id, user_id, creation_date, bounty_amount)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (id) DO NOTHING
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка подготовки запроса: %w", err)
-	}
-	defer insertStmt.Close()
-
-	rowProcessor := func(start *xml.StartElement) error {
-		attrs := startElementToMap(start)
-
-		id, _ := strconv.Atoi(attrs["Id"])
-		postId, _ := strconv.Atoi(attrs["PostId"])
-		voteTypeId, _ := strconv.Atoi(attrs["VoteTypeId"])
-
-		var userId sql.NullInt64
-		if val, ok := attrs["UserId"]; ok && val != "" {
-			id, _ := strconv.ParseInt(val, 10, 64)
-			userId = sql.NullInt64{Valid: true, Int64: id}
-		}
-
-		var bountyAmount sql.NullInt64
-		if val, ok := attrs["BountyAmount"]; ok && val != "" {
-			amount, _ := strconv.ParseInt(val, 10, 64)
-			bountyAmount = sql.NullInt64{Valid: true, Int64: amount}
+func (i *Importer) handleInvalidRow(ctx context.Context, file dumpFile, table string, pos rowPosition, rowErr *rowError) error {
+	i.summary.addRejects(file.site, table, 1)
+
+	switch i.validation {
+	case policyStrict:
+		return fmt.Errorf("%s, строка %d (смещение %d): %w", file, pos.line, pos.offset, rowErr)
+	case policyReject:
+		records := newRejectRecords(file, pos, rowErr)
+		// исходные значения атрибутов могут содержать персональные данные
+		if i.policy != nil {
+			for n := range records {
+				records[n].Value = ""
+			}
 		}
-
-		creationDate, _ := parseTime(attrs["CreationDate"])
-
-		_, err := insertStmt.Exec(
-			id, postId, voteTypeId, userId, creationDate, bountyAmount,
-		)
-		return err
+		return i.rejects.write(ctx, records)
 	}
 
-	return parseXmlFile(xmlFile, rowProcessor, i.logger)
+	i.logger.Debug("строка загружена с ошибками разбора",
+		zap.Stringer("file", file),
+		zap.Int("line", pos.line),
+		zap.Error(rowErr))
+	return nil
 }
@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// группа задач, которые можно выполнять одновременно;
+// группы выполняются строго по порядку
+type importStage []*entity
+
+// выполняет задачи группы на пуле из не более чем concurrency воркеров;
+// первая ошибка отменяет контекст, и оставшиеся задачи не запускаются
+func (i *Importer) runStage(ctx context.Context, site string, src dumpSource, stage importStage) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := i.concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(stage) {
+		workers = len(stage)
+	}
+
+	tasks := make(chan *entity)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	for w := 1; w <= workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for task := range tasks {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := i.runTask(ctx, worker, site, src, task); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}(w)
+	}
+
+	for _, task := range stage {
+		select {
+		case tasks <- task:
+		case <-ctx.Done():
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (i *Importer) runTask(ctx context.Context, worker int, site string, src dumpSource, task *entity) error {
+	logger := i.logger.With(
+		zap.Int("worker", worker),
+		zap.String("site", site),
+		zap.String("entity", task.name))
+
+	name, err := src.find(task.name)
+	if err != nil {
+		logger.Warn("файл не найден, пропускаем", zap.Error(err))
+		return nil
+	}
+	file := dumpFile{site: site, name: name, source: src}
+
+	cp, err := i.prepareCheckpoint(ctx, file)
+	if err != nil {
+		return fmt.Errorf("ошибка импорта %s: %w", task.name, err)
+	}
+	if cp == nil {
+		logger.Info("файл уже импортирован, пропускаем", zap.Stringer("file", file))
+		return nil
+	}
+	i.checkpoints.put(file, cp)
+
+	logger.Info("воркер начал импорт", zap.Stringer("file", file))
+	started := time.Now()
+
+	if err := i.importEntity(ctx, file, task); err != nil {
+		logger.Error("воркер завершил импорт с ошибкой", zap.Error(err))
+		if markErr := i.markCheckpoint(context.Background(), cp, stateFailed); markErr != nil {
+			logger.Error("не удалось сохранить состояние импорта", zap.Error(markErr))
+		}
+		return fmt.Errorf("ошибка импорта %s: %w", task.name, err)
+	}
+
+	if err := i.markCheckpoint(ctx, cp, stateDone); err != nil {
+		return err
+	}
+
+	logger.Info("воркер завершил импорт", zap.Duration("duration", time.Since(started)))
+	return nil
+}
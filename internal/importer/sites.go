@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// источник данных одного сайта: архив и/или уже распакованная директория
+type siteSource struct {
+	site       string
+	archive    string
+	extractDir string
+}
+
+func (s siteSource) hasArchive() bool {
+	return s.archive != ""
+}
+
+// ищет в dataDir архивы *.7z и директории с xml файлами; идентификатором
+// сайта служит имя архива без расширения или имя директории.
+// Если список sites не пуст, возвращаются только перечисленные сайты
+func discoverSites(dataDir string, sites []string) ([]siteSource, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения директории данных: %w", err)
+	}
+
+	found := make(map[string]*siteSource)
+	source := func(site string) *siteSource {
+		if s, ok := found[site]; ok {
+			return s
+		}
+		s := &siteSource{
+			site:       site,
+			extractDir: filepath.Join(dataDir, site),
+		}
+		found[site] = s
+		return s
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dataDir, name)
+
+		if entry.IsDir() {
+			if _, err := findXmlFile(path, ""); err == nil {
+				source(name)
+			}
+			continue
+		}
+
+		if strings.EqualFold(filepath.Ext(name), ".7z") {
+			site := strings.TrimSuffix(name, filepath.Ext(name))
+			source(site).archive = path
+		}
+	}
+
+	if len(sites) == 0 {
+		result := make([]siteSource, 0, len(found))
+		for _, s := range found {
+			result = append(result, *s)
+		}
+		sort.Slice(result, func(a, b int) bool {
+			return result[a].site < result[b].site
+		})
+		return result, nil
+	}
+
+	result := make([]siteSource, 0, len(sites))
+	var missing []string
+	for _, site := range sites {
+		s, ok := found[site]
+		if !ok {
+			missing = append(missing, site)
+			continue
+		}
+		result = append(result, *s)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("данные сайтов не найдены в %s: %s", dataDir, strings.Join(missing, ", "))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/database"
+)
+
+// регистрирует дамп сайта в таблице dumps и возвращает его dump_id.
+// Снимки загружаются в хронологическом порядке: версии строк закрываются
+// датой нового дампа, поэтому дамп старше последнего загруженного отклоняется
+func (i *Importer) registerDump(ctx context.Context, site string) (int, error) {
+	var latest *string
+	err := i.db.GetContext(ctx, &latest,
+		"SELECT max(dump_date)::text FROM dumps WHERE site = $1", site)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения списка дампов: %w", err)
+	}
+	if latest != nil && *latest > i.dumpDate {
+		return 0, fmt.Errorf("дамп %s сайта %s старше последнего загруженного снимка %s",
+			i.dumpDate, site, *latest)
+	}
+
+	var dumpID int
+	err = i.db.GetContext(ctx, &dumpID, `
+		INSERT INTO dumps (site, dump_date)
+		VALUES ($1, $2)
+		ON CONFLICT (site, dump_date) DO UPDATE SET created_at = now()
+		RETURNING dump_id
+	`, site, i.dumpDate)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка регистрации дампа: %w", err)
+	}
+
+	i.logger.Info("снимок дампа зарегистрирован",
+		zap.String("site", site),
+		zap.String("dump_date", i.dumpDate),
+		zap.Int("dump_id", dumpID))
+	return dumpID, nil
+}
+
+// сверяет версии строк таблицы с её текущим содержимым после загрузки дампа:
+// изменённые и удалённые строки закрываются датой дампа, новые и изменённые
+// получают открытую версию с valid_from = дата дампа
+func (i *Importer) recordSnapshot(ctx context.Context, target database.Target, site string) error {
+	dumpID, ok := i.dumpIDs[site]
+	if !ok {
+		return fmt.Errorf("дамп сайта %s не зарегистрирован", site)
+	}
+
+	versions := target.Table + "_versions"
+	columns := strings.Join(target.Columns, ", ")
+	same := fmt.Sprintf("(t.%s) IS NOT DISTINCT FROM (v.%s)",
+		strings.Join(target.Columns, ", t."), strings.Join(target.Columns, ", v."))
+
+	tx, err := i.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	// повторная загрузка того же дампа заменяет версии, открытые им самим
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s v
+		WHERE v.site = $1 AND v.valid_from = $2
+		AND NOT EXISTS (
+			SELECT 1 FROM %s t
+			WHERE t.site = v.site AND t.id = v.id AND %s
+		)
+	`, versions, target.Table, same), site, i.dumpDate)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления версий повторного дампа: %w", err)
+	}
+
+	closed, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %s v SET valid_to = $2
+		WHERE v.site = $1 AND v.valid_to IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM %s t
+			WHERE t.site = v.site AND t.id = v.id AND %s
+		)
+	`, versions, target.Table, same), site, i.dumpDate)
+	if err != nil {
+		return fmt.Errorf("ошибка закрытия версий строк: %w", err)
+	}
+
+	opened, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s, dump_id, valid_from)
+		SELECT %s, $3, $2 FROM %s t
+		WHERE t.site = $1
+		AND NOT EXISTS (
+			SELECT 1 FROM %s v
+			WHERE v.site = t.site AND v.id = t.id AND v.valid_to IS NULL
+		)
+	`, versions, columns, columns, target.Table, versions), site, i.dumpDate, dumpID)
+	if err != nil {
+		return fmt.Errorf("ошибка записи версий строк: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+
+	closedRows, _ := closed.RowsAffected()
+	openedRows, _ := opened.RowsAffected()
+	i.logger.Info("снимок таблицы записан",
+		zap.String("site", site),
+		zap.String("table", target.Table),
+		zap.Int("dump_id", dumpID),
+		zap.Int64("closed", closedRows),
+		zap.Int64("opened", openedRows))
+	return nil
+}
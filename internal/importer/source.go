@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// источник xml файлов дампа одного сайта
+type dumpSource interface {
+	// ищет файл сущности, например Posts для Posts.xml
+	find(entityType string) (string, error)
+	open(name string) (io.ReadCloser, error)
+	checksum(name string) (string, error)
+	Close() error
+}
+
+// xml файл дампа сайта: файл на диске или запись внутри 7z архива
+type dumpFile struct {
+	site   string
+	name   string
+	source dumpSource
+}
+
+func (f dumpFile) open() (io.ReadCloser, error) {
+	return f.source.open(f.name)
+}
+
+func (f dumpFile) String() string {
+	return f.name
+}
+
+// распакованная директория сайта
+type dirSource struct {
+	dir string
+}
+
+func (s *dirSource) find(entityType string) (string, error) {
+	return findXmlFile(s.dir, entityType)
+}
+
+func (s *dirSource) open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (s *dirSource) checksum(name string) (string, error) {
+	return fileChecksum(name)
+}
+
+func (s *dirSource) Close() error {
+	return nil
+}
+
+// 7z архив, записи которого читаются потоком без распаковки на диск
+type archiveSource struct {
+	path    string
+	archive *sevenzip.ReadCloser
+}
+
+func openArchiveSource(archivePath string) (*archiveSource, error) {
+	archive, err := sevenzip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть архив: %w", err)
+	}
+	return &archiveSource{path: archivePath, archive: archive}, nil
+}
+
+func (s *archiveSource) entry(name string) (*sevenzip.File, error) {
+	for _, entry := range s.archive.File {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("запись %s не найдена в архиве %s", name, s.path)
+}
+
+func (s *archiveSource) find(entityType string) (string, error) {
+	for _, entry := range s.archive.File {
+		if matchesEntity(path.Base(entry.Name), entityType) {
+			return entry.Name, nil
+		}
+	}
+	return "", fmt.Errorf("файл типа %s не найден в архиве %s", entityType, s.path)
+}
+
+func (s *archiveSource) open(name string) (io.ReadCloser, error) {
+	entry, err := s.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Open()
+}
+
+// для записей архива используем размер и CRC32 из заголовка: это не требует распаковки
+func (s *archiveSource) checksum(name string) (string, error) {
+	entry, err := s.entry(name)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:%08x", entry.UncompressedSize, entry.CRC32)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *archiveSource) Close() error {
+	return s.archive.Close()
+}
+
+func matchesEntity(fileName, entityType string) bool {
+	fileName = strings.ToLower(fileName)
+	return strings.HasSuffix(fileName, ".xml") &&
+		strings.Contains(fileName, strings.ToLower(entityType))
+}
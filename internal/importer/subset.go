@@ -0,0 +1,228 @@
+package importer
+
+import (
+	"context"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/config"
+	"stackexchange-data-analysis/internal/models"
+)
+
+// при выборочном импорте пользователи и значки загружаются последними:
+// их набор определяется ссылками загруженных постов, комментариев, голосов и правок
+var subsetStages = [][]string{
+	{"Posts"},
+	{"Comments", "Votes", "PostHistory", "PostLinks", "Tags"},
+	{"Users"},
+	{"Badges"},
+}
+
+// выборочный импорт: посты, отобранные по тегам, дате создания и типу,
+// и всё, что на них ссылается. Наборы id собираются в памяти по ходу импорта сайта
+type subsetFilter struct {
+	tags      map[string]bool
+	from, to  time.Time
+	postTypes map[int]bool
+
+	mu sync.Mutex
+	// посты, отобранные фильтрами, без ответов; заполняется предварительным проходом
+	roots map[int]bool
+	posts map[int]bool
+	users map[int]bool
+	// теги загруженных постов, по ним отбираются строки Tags
+	usedTags map[string]bool
+}
+
+// даты фильтра проверяются при загрузке конфигурации
+func newSubsetFilter(cfg config.SubsetConfig) *subsetFilter {
+	if len(cfg.Tags) == 0 && cfg.From == "" && cfg.To == "" && len(cfg.PostTypes) == 0 {
+		return nil
+	}
+
+	f := &subsetFilter{
+		tags:      make(map[string]bool),
+		postTypes: make(map[int]bool),
+	}
+	for _, tag := range cfg.Tags {
+		f.tags[strings.ToLower(tag)] = true
+	}
+
+	postTypes := cfg.PostTypes
+	if len(postTypes) == 0 {
+		// по умолчанию отбираются вопросы
+		postTypes = []int{1}
+	}
+	for _, postType := range postTypes {
+		f.postTypes[postType] = true
+	}
+
+	if cfg.From != "" {
+		f.from, _ = time.Parse("2006-01-02", cfg.From)
+	}
+	if cfg.To != "" {
+		f.to, _ = time.Parse("2006-01-02", cfg.To)
+	}
+	return f
+}
+
+func (f *subsetFilter) reset() {
+	f.roots = make(map[int]bool)
+	f.posts = make(map[int]bool)
+	f.users = make(map[int]bool)
+	f.usedTags = make(map[string]bool)
+}
+
+func attrValue(row *xml.StartElement, name string) string {
+	for _, attr := range row.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func attrInt(row *xml.StartElement, name string) (int, bool) {
+	id, err := strconv.Atoi(attrValue(row, name))
+	return id, err == nil
+}
+
+// теги поста в формате <a><b> или |a|b| в новых дампах
+func splitTags(tags string) []string {
+	return strings.FieldsFunc(strings.ToLower(tags), func(r rune) bool {
+		return r == '<' || r == '>' || r == '|'
+	})
+}
+
+// проверяет пост по фильтрам тегов, даты создания и типа
+func (f *subsetFilter) matchesRoot(row *xml.StartElement) bool {
+	postType, ok := attrInt(row, "PostTypeId")
+	if !ok || !f.postTypes[postType] {
+		return false
+	}
+
+	if !f.from.IsZero() || !f.to.IsZero() {
+		created, err := time.Parse(models.TimeLayout, attrValue(row, "CreationDate"))
+		if err != nil {
+			return false
+		}
+		if !f.from.IsZero() && created.Before(f.from) {
+			return false
+		}
+		if !f.to.IsZero() && !created.Before(f.to) {
+			return false
+		}
+	}
+
+	if len(f.tags) == 0 {
+		return true
+	}
+	for _, tag := range splitTags(attrValue(row, "Tags")) {
+		if f.tags[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// предварительный проход по Posts.xml: ответы могут встретиться в файле раньше
+// вопроса, поэтому отобранные вопросы нужно знать до загрузки постов
+func (i *Importer) selectSubsetRoots(site string, src dumpSource) error {
+	name, err := src.find("Posts")
+	if err != nil {
+		return err
+	}
+	file := dumpFile{site: site, name: name, source: src}
+
+	i.logger.Info("выборочный импорт: отбор постов", zap.Stringer("file", file))
+	err = i.parseFile(file, func(row *xml.StartElement, _ rowPosition) error {
+		if id, ok := attrInt(row, "Id"); ok && i.subset.matchesRoot(row) {
+			i.subset.roots[id] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(i.subset.roots) == 0 {
+		i.logger.Warn("выборочный импорт: ни один пост не прошёл фильтры", zap.String("site", site))
+	}
+	return nil
+}
+
+func (f *subsetFilter) addUser(row *xml.StartElement, attribute string) {
+	if id, ok := attrInt(row, attribute); ok {
+		f.users[id] = true
+	}
+}
+
+// решает, входит ли строка таблицы в выборку, и пополняет наборы id,
+// на которые она ссылается
+func (f *subsetFilter) accept(table string, row *xml.StartElement) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch table {
+	case "posts":
+		id, _ := attrInt(row, "Id")
+		parent, isAnswer := attrInt(row, "ParentId")
+		if !f.roots[id] && !(isAnswer && f.roots[parent]) {
+			return false
+		}
+		f.posts[id] = true
+		f.addUser(row, "OwnerUserId")
+		f.addUser(row, "LastEditorUserId")
+		for _, tag := range splitTags(attrValue(row, "Tags")) {
+			f.usedTags[tag] = true
+		}
+	case "comments", "votes", "post_history":
+		postID, _ := attrInt(row, "PostId")
+		if !f.posts[postID] {
+			return false
+		}
+		f.addUser(row, "UserId")
+	case "post_links":
+		postID, _ := attrInt(row, "PostId")
+		relatedID, _ := attrInt(row, "RelatedPostId")
+		return f.posts[postID] && f.posts[relatedID]
+	case "tags":
+		return f.usedTags[strings.ToLower(attrValue(row, "TagName"))]
+	case "users":
+		id, _ := attrInt(row, "Id")
+		return f.users[id]
+	case "badges":
+		userID, _ := attrInt(row, "UserId")
+		return f.users[userID]
+	}
+	return true
+}
+
+func (f *subsetFilter) log(logger *zap.Logger, site string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	logger.Info("выборочный импорт: итоги отбора",
+		zap.String("site", site),
+		zap.Int("selected_posts", len(f.roots)),
+		zap.Int("posts", len(f.posts)),
+		zap.Int("users", len(f.users)),
+		zap.Int("tags", len(f.usedTags)))
+}
+
+// хуки after откладываются до конца импорта сайта: очистка постов обнуляет
+// ссылки на пользователей, которые при выборочном импорте загружаются позже
+func (i *Importer) runDeferredHooks(ctx context.Context, site string) error {
+	for _, e := range entities {
+		if e.after == nil {
+			continue
+		}
+		if err := e.after(i, ctx, site); err != nil {
+			return err
+		}
+	}
+	return nil
+}
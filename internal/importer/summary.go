@@ -0,0 +1,93 @@
+package importer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// итоги импорта одного сайта
+type siteSummary struct {
+	site     string
+	rows     map[string]int
+	rejects  map[string]int
+	duration time.Duration
+	err      error
+}
+
+// собирает итоги импорта по сайтам; безопасна для параллельных воркеров
+type importSummary struct {
+	mu    sync.Mutex
+	sites []*siteSummary
+}
+
+func (s *importSummary) get(site string) *siteSummary {
+	for _, summary := range s.sites {
+		if summary.site == site {
+			return summary
+		}
+	}
+
+	summary := &siteSummary{
+		site:    site,
+		rows:    make(map[string]int),
+		rejects: make(map[string]int),
+	}
+	s.sites = append(s.sites, summary)
+	return summary
+}
+
+func (s *importSummary) addRows(site, table string, rows int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(site).rows[table] += rows
+}
+
+func (s *importSummary) addRejects(site, table string, rows int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(site).rejects[table] += rows
+}
+
+func (s *importSummary) finish(site string, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := s.get(site)
+	summary.duration = duration
+	summary.err = err
+}
+
+func (s *importSummary) log(logger *zap.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, summary := range s.sites {
+		tables := make([]string, 0, len(summary.rows))
+		for table := range summary.rows {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+
+		total := 0
+		fields := []zap.Field{
+			zap.String("site", summary.site),
+			zap.Duration("duration", summary.duration),
+		}
+		for _, table := range tables {
+			total += summary.rows[table]
+			fields = append(fields, zap.Int(table, summary.rows[table]))
+		}
+		fields = append(fields, zap.Int("total_rows", total))
+		if len(summary.rejects) > 0 {
+			fields = append(fields, zap.Any("rejects", summary.rejects))
+		}
+
+		if summary.err != nil {
+			logger.Error("итоги импорта сайта", append(fields, zap.Error(summary.err))...)
+		} else {
+			logger.Info("итоги импорта сайта", fields...)
+		}
+	}
+}
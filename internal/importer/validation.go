@@ -0,0 +1,140 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// политики обработки строк, которые не удалось разобрать
+const (
+	// строка загружается с нулевыми значениями в проблемных полях
+	policyLenient = "lenient"
+	// строка пропускается и записывается в журнал отклонённых строк
+	policyReject = "reject"
+	// импорт прерывается на первой некорректной строке
+	policyStrict = "strict"
+)
+
+func validPolicy(policy string) bool {
+	switch policy {
+	case policyLenient, policyReject, policyStrict:
+		return true
+	}
+	return false
+}
+
+// позиция строки в xml файле
+type rowPosition struct {
+	line   int
+	offset int64
+}
+
+type fieldError struct {
+	attribute string
+	value     string
+	err       error
+}
+
+// ошибка разбора строки дампа со списком проблемных атрибутов
+type rowError struct {
+	fields []fieldError
+}
+
+func (e *rowError) Error() string {
+	parts := make([]string, 0, len(e.fields))
+	for _, f := range e.fields {
+		parts = append(parts, fmt.Sprintf("%s=%q: %v", f.attribute, f.value, f.err))
+	}
+	return "некорректная строка: " + strings.Join(parts, "; ")
+}
+
+// запись журнала отклонённых строк
+type rejectRecord struct {
+	Site      string    `json:"site" db:"site"`
+	File      string    `json:"file" db:"file"`
+	Line      int       `json:"line" db:"line"`
+	Offset    int64     `json:"offset" db:"byte_offset"`
+	Attribute string    `json:"attribute" db:"attribute"`
+	Value     string    `json:"value" db:"value"`
+	Error     string    `json:"error" db:"error"`
+	Time      time.Time `json:"time" db:"created_at"`
+}
+
+// журнал отклонённых строк: таблица import_rejects или NDJSON файл
+type rejectLog interface {
+	write(ctx context.Context, records []rejectRecord) error
+	Close() error
+}
+
+type tableRejectLog struct {
+	db *sqlx.DB
+}
+
+func (l *tableRejectLog) write(ctx context.Context, records []rejectRecord) error {
+	_, err := l.db.NamedExecContext(ctx, `
+		INSERT INTO import_rejects (site, file, line, byte_offset, attribute, value, error, created_at)
+		VALUES (:site, :file, :line, :byte_offset, :attribute, :value, :error, :created_at)
+	`, records)
+	if err != nil {
+		return fmt.Errorf("ошибка записи в import_rejects: %w", err)
+	}
+	return nil
+}
+
+func (l *tableRejectLog) Close() error {
+	return nil
+}
+
+type fileRejectLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func newFileRejectLog(path string) (*fileRejectLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть журнал отклонённых строк: %w", err)
+	}
+	return &fileRejectLog{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (l *fileRejectLog) write(_ context.Context, records []rejectRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, record := range records {
+		if err := l.encoder.Encode(record); err != nil {
+			return fmt.Errorf("ошибка записи журнала отклонённых строк: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *fileRejectLog) Close() error {
+	return l.file.Close()
+}
+
+func newRejectRecords(file dumpFile, pos rowPosition, rowErr *rowError) []rejectRecord {
+	now := time.Now()
+	records := make([]rejectRecord, 0, len(rowErr.fields))
+	for _, f := range rowErr.fields {
+		records = append(records, rejectRecord{
+			Site:      file.site,
+			File:      file.String(),
+			Line:      pos.line,
+			Offset:    pos.offset,
+			Attribute: f.attribute,
+			Value:     f.value,
+			Error:     f.err.Error(),
+			Time:      now,
+		})
+	}
+	return records
+}
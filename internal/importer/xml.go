@@ -4,38 +4,11 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"go.uber.org/zap"
 )
 
-func extract7zArchive(archivePath, outputDir string, logger *zap.Logger) error {
-	logger.Info("распаковка архива", zap.String("archive", archivePath))
-
-	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
-		return fmt.Errorf("архив не найден: %s", archivePath)
-	}
-
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("не удалось создать директорию для извлечения: %w", err)
-	}
-
-	cmd := exec.Command("7z", "x", archivePath, "-o"+outputDir, "-y")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		logger.Error("ошибка распаковки архива",
-			zap.String("output", string(output)),
-			zap.Error(err))
-		return fmt.Errorf("ошибка при распаковке архива: %w", err)
-	}
-
-	logger.Info("архив успешно распакован", zap.String("output_dir", outputDir))
-	return nil
-}
-
 func findXmlFile(directory, fileType string) (string, error) {
 	pattern := fmt.Sprintf("%s/*.xml", directory)
 	files, err := filepath.Glob(pattern)
@@ -48,10 +21,8 @@ func findXmlFile(directory, fileType string) (string, error) {
 	}
 
 	if fileType != "" {
-		fileTypeLower := strings.ToLower(fileType)
 		for _, file := range files {
-			baseFileName := strings.ToLower(filepath.Base(file))
-			if strings.Contains(baseFileName, fileTypeLower) {
+			if matchesEntity(filepath.Base(file), fileType) {
 				return file, nil
 			}
 		}
@@ -61,10 +32,10 @@ func findXmlFile(directory, fileType string) (string, error) {
 	return files[0], nil
 }
 
-func parseXmlFile(filePath string, rowProcessor func(row *xml.StartElement) error, logger *zap.Logger) error {
-	logger.Info("начало парсинга xml файла", zap.String("file", filePath))
+func parseXmlFile(dump dumpFile, rowProcessor func(row *xml.StartElement, pos rowPosition) error, logger *zap.Logger) error {
+	logger.Info("начало парсинга xml файла", zap.Stringer("file", dump))
 
-	file, err := os.Open(filePath)
+	file, err := dump.open()
 	if err != nil {
 		return fmt.Errorf("не удалось открыть файл: %w", err)
 	}
@@ -74,6 +45,11 @@ func parseXmlFile(filePath string, rowProcessor func(row *xml.StartElement) erro
 	var rowCount int
 
 	for {
+		// позиция до чтения токена указывает на начало очередной строки
+		var pos rowPosition
+		pos.line, _ = decoder.InputPos()
+		pos.offset = decoder.InputOffset()
+
 		token, err := decoder.Token()
 		if err == io.EOF {
 			break
@@ -84,7 +60,7 @@ func parseXmlFile(filePath string, rowProcessor func(row *xml.StartElement) erro
 
 		if startElement, ok := token.(xml.StartElement); ok {
 			if startElement.Name.Local == "row" {
-				if err := rowProcessor(&startElement); err != nil {
+				if err := rowProcessor(&startElement, pos); err != nil {
 					return fmt.Errorf("ошибка обработки строки: %w", err)
 				}
 
@@ -97,16 +73,8 @@ func parseXmlFile(filePath string, rowProcessor func(row *xml.StartElement) erro
 	}
 
 	logger.Info("парсинг файла завершен",
-		zap.String("file", filePath),
+		zap.Stringer("file", dump),
 		zap.Int("total_rows", rowCount))
 
 	return nil
 }
-
-func startElementToMap(start *xml.StartElement) map[string]string {
-	attrMap := make(map[string]string)
-	for _, attr := range start.Attr {
-		attrMap[attr.Name.Local] = attr.Value
-	}
-	return attrMap
-}
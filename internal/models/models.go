@@ -2,103 +2,104 @@ package models
 
 import (
 	"encoding/xml"
-	"time"
 )
 
+// порядок полей моделей повторяет порядок атрибутов в дампах Stack Exchange:
+// в этом порядке атрибуты записываются при экспорте
 type BaseRow struct {
-	ID   int    `xml:"Id,attr"`
+	ID   int    `xml:"Id,attr" db:"id"`
 	Type string `xml:",name"`
 }
 
 type User struct {
 	BaseRow
-	Reputation     int       `xml:"Reputation,attr"`
-	CreationDate   time.Time `xml:"CreationDate,attr"`
-	DisplayName    string    `xml:"DisplayName,attr"`
-	LastAccessDate time.Time `xml:"LastAccessDate,attr,omitempty"`
-	WebsiteUrl     string    `xml:"WebsiteUrl,attr,omitempty"`
-	Location       string    `xml:"Location,attr,omitempty"`
-	AboutMe        string    `xml:"AboutMe,attr,omitempty"`
-	Views          int       `xml:"Views,attr,omitempty"`
-	UpVotes        int       `xml:"UpVotes,attr,omitempty"`
-	DownVotes      int       `xml:"DownVotes,attr,omitempty"`
-	AccountId      int       `xml:"AccountId,attr,omitempty"`
+	Reputation     int    `xml:"Reputation,attr" db:"reputation"`
+	CreationDate   Time   `xml:"CreationDate,attr" db:"creation_date"`
+	DisplayName    string `xml:"DisplayName,attr" db:"display_name"`
+	LastAccessDate *Time  `xml:"LastAccessDate,attr,omitempty" db:"last_access_date"`
+	WebsiteUrl     string `xml:"WebsiteUrl,attr,omitempty" db:"website_url"`
+	Location       string `xml:"Location,attr,omitempty" db:"location"`
+	AboutMe        string `xml:"AboutMe,attr,omitempty" db:"about_me"`
+	Views          int    `xml:"Views,attr,omitempty" db:"views"`
+	UpVotes        int    `xml:"UpVotes,attr,omitempty" db:"up_votes"`
+	DownVotes      int    `xml:"DownVotes,attr,omitempty" db:"down_votes"`
+	AccountId      *int   `xml:"AccountId,attr,omitempty" db:"account_id"`
 }
 
 type Post struct {
 	BaseRow
-	PostTypeID         int       `xml:"PostTypeId,attr"`
-	AcceptedAnswerID   int       `xml:"AcceptedAnswerId,attr,omitempty"`
-	CreationDate       time.Time `xml:"CreationDate,attr"`
-	Score              int       `xml:"Score,attr"`
-	ViewCount          int       `xml:"ViewCount,attr,omitempty"`
-	Body               string    `xml:"Body,attr,omitempty"`
-	OwnerUserID        int       `xml:"OwnerUserId,attr,omitempty"`
-	LastEditorUserID   int       `xml:"LastEditorUserId,attr,omitempty"`
-	LastEditDate       time.Time `xml:"LastEditDate,attr,omitempty"`
-	LastActivityDate   time.Time `xml:"LastActivityDate,attr,omitempty"`
-	Title              string    `xml:"Title,attr,omitempty"`
-	Tags               string    `xml:"Tags,attr,omitempty"`
-	AnswerCount        int       `xml:"AnswerCount,attr,omitempty"`
-	CommentCount       int       `xml:"CommentCount,attr,omitempty"`
-	FavoriteCount      int       `xml:"FavoriteCount,attr,omitempty"`
-	ClosedDate         time.Time `xml:"ClosedDate,attr,omitempty"`
-	ParentID           int       `xml:"ParentId,attr,omitempty"`
-	CommunityOwnedDate time.Time `xml:"CommunityOwnedDate,attr,omitempty"`
+	PostTypeID         int    `xml:"PostTypeId,attr" db:"post_type_id"`
+	AcceptedAnswerID   *int   `xml:"AcceptedAnswerId,attr,omitempty" db:"accepted_answer_id"`
+	ParentID           *int   `xml:"ParentId,attr,omitempty" db:"parent_id"`
+	CreationDate       Time   `xml:"CreationDate,attr" db:"creation_date"`
+	Score              int    `xml:"Score,attr" db:"score"`
+	ViewCount          *int   `xml:"ViewCount,attr,omitempty" db:"view_count"`
+	Body               string `xml:"Body,attr,omitempty" db:"body"`
+	OwnerUserID        *int   `xml:"OwnerUserId,attr,omitempty" db:"owner_user_id"`
+	LastEditorUserID   *int   `xml:"LastEditorUserId,attr,omitempty" db:"last_editor_user_id"`
+	LastEditDate       *Time  `xml:"LastEditDate,attr,omitempty" db:"last_edit_date"`
+	LastActivityDate   *Time  `xml:"LastActivityDate,attr,omitempty" db:"last_activity_date"`
+	Title              string `xml:"Title,attr,omitempty" db:"title"`
+	Tags               string `xml:"Tags,attr,omitempty" db:"tags"`
+	AnswerCount        *int   `xml:"AnswerCount,attr,omitempty" db:"answer_count"`
+	CommentCount       *int   `xml:"CommentCount,attr,omitempty" db:"comment_count"`
+	FavoriteCount      *int   `xml:"FavoriteCount,attr,omitempty" db:"favorite_count"`
+	ClosedDate         *Time  `xml:"ClosedDate,attr,omitempty" db:"closed_date"`
+	CommunityOwnedDate *Time  `xml:"CommunityOwnedDate,attr,omitempty" db:"community_owned_date"`
 }
 
 type Comment struct {
 	BaseRow
-	PostID       int       `xml:"PostId,attr"`
-	Score        int       `xml:"Score,attr,omitempty"`
-	Text         string    `xml:"Text,attr"`
-	CreationDate time.Time `xml:"CreationDate,attr"`
-	UserID       int       `xml:"UserId,attr,omitempty"`
+	PostID       int    `xml:"PostId,attr" db:"post_id"`
+	Score        int    `xml:"Score,attr,omitempty" db:"score"`
+	Text         string `xml:"Text,attr" db:"text"`
+	CreationDate Time   `xml:"CreationDate,attr" db:"creation_date"`
+	UserID       *int   `xml:"UserId,attr,omitempty" db:"user_id"`
 }
 
 type Badge struct {
 	BaseRow
-	UserID   int       `xml:"UserId,attr"`
-	Name     string    `xml:"Name,attr"`
-	Date     time.Time `xml:"Date,attr"`
-	Class    int       `xml:"Class,attr,omitempty"`
-	TagBased bool      `xml:"TagBased,attr,omitempty"`
+	UserID   int    `xml:"UserId,attr" db:"user_id"`
+	Name     string `xml:"Name,attr" db:"name"`
+	Date     Time   `xml:"Date,attr" db:"date"`
+	Class    int    `xml:"Class,attr,omitempty" db:"class"`
+	TagBased bool   `xml:"TagBased,attr,omitempty" db:"tag_based"`
 }
 
 type PostHistory struct {
 	BaseRow
-	PostID            int       `xml:"PostId,attr"`
-	RevisionGUID      string    `xml:"RevisionGUID,attr,omitempty"`
-	CreationDate      time.Time `xml:"CreationDate,attr"`
-	UserID            int       `xml:"UserId,attr,omitempty"`
-	PostHistoryTypeID int       `xml:"PostHistoryTypeId,attr"`
-	Text              string    `xml:"Text,attr,omitempty"`
-	Comment           string    `xml:"Comment,attr,omitempty"`
+	PostHistoryTypeID int    `xml:"PostHistoryTypeId,attr" db:"post_history_type_id"`
+	PostID            int    `xml:"PostId,attr" db:"post_id"`
+	RevisionGUID      string `xml:"RevisionGUID,attr,omitempty" db:"revision_guid"`
+	CreationDate      Time   `xml:"CreationDate,attr" db:"creation_date"`
+	UserID            *int   `xml:"UserId,attr,omitempty" db:"user_id"`
+	Comment           string `xml:"Comment,attr,omitempty" db:"comment"`
+	Text              string `xml:"Text,attr,omitempty" db:"text"`
 }
 
 type PostLink struct {
 	BaseRow
-	CreationDate  time.Time `xml:"CreationDate,attr"`
-	PostID        int       `xml:"PostId,attr"`
-	RelatedPostID int       `xml:"RelatedPostId,attr"`
-	LinkTypeID    int       `xml:"LinkTypeId,attr"`
+	CreationDate  Time `xml:"CreationDate,attr" db:"creation_date"`
+	PostID        int  `xml:"PostId,attr" db:"post_id"`
+	RelatedPostID int  `xml:"RelatedPostId,attr" db:"related_post_id"`
+	LinkTypeID    int  `xml:"LinkTypeId,attr" db:"link_type_id"`
 }
 
 type Tag struct {
 	BaseRow
-	TagName       string `xml:"TagName,attr"`
-	Count         int    `xml:"Count,attr"`
-	ExcerptPostID int    `xml:"ExcerptPostId,attr,omitempty"`
-	WikiPostID    int    `xml:"WikiPostId,attr,omitempty"`
+	TagName       string `xml:"TagName,attr" db:"tag_name"`
+	Count         int    `xml:"Count,attr" db:"count"`
+	ExcerptPostID *int   `xml:"ExcerptPostId,attr,omitempty" db:"excerpt_post_id"`
+	WikiPostID    *int   `xml:"WikiPostId,attr,omitempty" db:"wiki_post_id"`
 }
 
 type Vote struct {
 	BaseRow
-	PostID       int       `xml:"PostId,attr"`
-	VoteTypeID   int       `xml:"VoteTypeId,attr"`
-	UserID       int       `xml:"UserId,attr,omitempty"`
-	CreationDate time.Time `xml:"CreationDate,attr"`
-	BountyAmount int       `xml:"BountyAmount,attr,omitempty"`
+	PostID       int  `xml:"PostId,attr" db:"post_id"`
+	VoteTypeID   int  `xml:"VoteTypeId,attr" db:"vote_type_id"`
+	UserID       *int `xml:"UserId,attr,omitempty" db:"user_id"`
+	CreationDate Time `xml:"CreationDate,attr" db:"creation_date"`
+	BountyAmount *int `xml:"BountyAmount,attr,omitempty" db:"bounty_amount"`
 }
 
 type Row struct {
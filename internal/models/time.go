@@ -0,0 +1,28 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/xml"
+	"time"
+)
+
+// формат меток времени в дампах Stack Exchange
+const TimeLayout = "2006-01-02T15:04:05.000"
+
+// Time — метка времени дампа, разбираемая из xml атрибута в формате TimeLayout
+type Time struct {
+	time.Time
+}
+
+func (t *Time) UnmarshalXMLAttr(attr xml.Attr) error {
+	parsed, err := time.Parse(TimeLayout, attr.Value)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+func (t Time) Value() (driver.Value, error) {
+	return t.Time, nil
+}
@@ -0,0 +1,323 @@
+package queries
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/database"
+	"stackexchange-data-analysis/internal/explain"
+)
+
+// параметры замера производительности запросов
+type BenchOptions struct {
+	// число замеряемых выполнений каждого запроса
+	Iterations int `json:"iterations"`
+	// число выполнений до замера для прогрева кэшей
+	Warmup int `json:"warmup"`
+	// число соединений, одновременно выполняющих запрос
+	Concurrency int `json:"concurrency"`
+	// каждое выполнение в новом соединении после DISCARD ALL
+	DropCache bool `json:"drop_cache"`
+	// ревизия git, на которой выполняется замер
+	Revision string `json:"-"`
+}
+
+// итоги замера одного запроса; буферы — в среднем на выполнение (только Postgres)
+type BenchResult struct {
+	Query            string
+	File             string
+	Iterations       int
+	Min              time.Duration
+	Median           time.Duration
+	P95              time.Duration
+	Max              time.Duration
+	Mean             time.Duration
+	SharedHitBlocks  int64
+	SharedReadBlocks int64
+	HasBuffers       bool
+}
+
+// одно выполнение запроса
+type benchSample struct {
+	elapsed    time.Duration
+	hit, read  int64
+	hasBuffers bool
+}
+
+// Bench выполняет запросы каталога по options.Iterations раз и сохраняет итоги
+// каждого запроса в таблицу query_runs
+func (q *QueryRunner) Bench(queries []*Query, options BenchOptions) ([]BenchResult, error) {
+	if options.Iterations <= 0 {
+		return nil, fmt.Errorf("число выполнений должно быть больше нуля")
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if q.params != nil {
+		if err := q.params.Check(queries); err != nil {
+			return nil, err
+		}
+	}
+
+	runID := time.Now().UTC().Format("20060102T150405.000Z")
+	q.logger.Info("замер производительности запросов",
+		zap.String("run_id", runID),
+		zap.Int("queries", len(queries)),
+		zap.Int("iterations", options.Iterations),
+		zap.Int("warmup", options.Warmup),
+		zap.Int("concurrency", options.Concurrency),
+		zap.Bool("drop_cache", options.DropCache),
+		zap.String("revision", options.Revision))
+
+	ctx := context.Background()
+	var results []BenchResult
+	for _, query := range queries {
+		query = query.For(q.store.Driver())
+
+		missing, err := q.MissingObjects(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			q.logger.Warn("в базе нет объектов, нужных запросу, пропускаем",
+				zap.String("query", query.Name),
+				zap.Strings("missing", missing))
+			continue
+		}
+
+		stmt, err := q.prepare(query)
+		if err != nil {
+			return nil, err
+		}
+		if !stmt.returnsRows() {
+			return nil, fmt.Errorf("%s: строка %d: замер неприменим к оператору вида %s без строк результата", stmt.path, stmt.line, stmt.kind)
+		}
+
+		result, err := q.benchQuery(ctx, query, stmt, options)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка замера запроса %s: %w", query.Name, err)
+		}
+		if err := q.recordRun(ctx, runID, stmt, result, options); err != nil {
+			return nil, err
+		}
+
+		q.logger.Info("замер запроса завершён",
+			zap.String("query", result.Query),
+			zap.Duration("min", result.Min),
+			zap.Duration("median", result.Median),
+			zap.Duration("p95", result.P95),
+			zap.Duration("max", result.Max))
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (q *QueryRunner) benchQuery(ctx context.Context, query *Query, stmt *statement, options BenchOptions) (BenchResult, error) {
+	for n := 0; n < options.Warmup; n++ {
+		if _, err := q.benchOnce(ctx, stmt, options.DropCache); err != nil {
+			return BenchResult{}, err
+		}
+	}
+
+	jobs := make(chan struct{}, options.Iterations)
+	for n := 0; n < options.Iterations; n++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	var (
+		mu       sync.Mutex
+		samples  []benchSample
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < options.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				sample, err := q.benchOnce(ctx, stmt, options.DropCache)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+				samples = append(samples, sample)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return BenchResult{}, firstErr
+	}
+
+	return summarize(query.Name, stmt.path, samples), nil
+}
+
+// выполняет запрос один раз. В Postgres запрос выполняется через EXPLAIN ANALYZE
+// без времени узлов, чтобы получить буферы, а строки результата не передаются клиенту
+func (q *QueryRunner) benchOnce(ctx context.Context, stmt *statement, dropCache bool) (benchSample, error) {
+	conn, err := q.siteConn(ctx)
+	if err != nil {
+		return benchSample{}, err
+	}
+	defer conn.Close()
+
+	if dropCache {
+		// соединение не возвращается в пул: следующее выполнение получит новое
+		defer conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+
+		if err := q.store.DiscardSession(ctx, conn, q.site); err != nil {
+			return benchSample{}, err
+		}
+		if q.asOf != "" {
+			if err := q.selectSnapshot(ctx, conn); err != nil {
+				return benchSample{}, err
+			}
+		}
+	}
+	// каждое выполнение откатывается, чтобы замер не изменял данные
+	tx, err := q.beginQuery(ctx, conn, stmt)
+	if err != nil {
+		return benchSample{}, err
+	}
+	defer tx.Rollback()
+
+	if q.store.Driver() == database.DriverPostgres {
+		return benchPostgres(ctx, tx, stmt)
+	}
+	return benchRows(ctx, tx, stmt)
+}
+
+func benchPostgres(ctx context.Context, tx *queryTx, stmt *statement) (benchSample, error) {
+	var planJSON []byte
+	started := time.Now()
+	if err := tx.QueryRowContext(ctx, explain.TimingOffPrefix+stmt.text, stmt.args...).Scan(&planJSON); err != nil {
+		return benchSample{}, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	elapsed := time.Since(started)
+
+	plan, err := explain.Parse(planJSON)
+	if err != nil {
+		return benchSample{}, err
+	}
+	return benchSample{
+		elapsed:    elapsed,
+		hit:        plan.Root.SharedHitBlocks,
+		read:       plan.Root.SharedReadBlocks,
+		hasBuffers: true,
+	}, nil
+}
+
+// выполняет запрос и вычитывает все строки результата
+func benchRows(ctx context.Context, tx *queryTx, stmt *statement) (benchSample, error) {
+	started := time.Now()
+	rows, err := tx.QueryContext(ctx, stmt.text, stmt.args...)
+	if err != nil {
+		return benchSample{}, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return benchSample{}, err
+	}
+	values := make([]interface{}, len(columns))
+	for n := range values {
+		values[n] = new(interface{})
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return benchSample{}, fmt.Errorf("ошибка сканирования результатов: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return benchSample{}, err
+	}
+	return benchSample{elapsed: time.Since(started)}, nil
+}
+
+// percentile по методу ближайшего ранга; durations отсортированы
+func percentile(durations []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(durations)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return durations[rank]
+}
+
+func summarize(name, file string, samples []benchSample) BenchResult {
+	durations := make([]time.Duration, len(samples))
+	var total time.Duration
+	result := BenchResult{Query: name, File: file, Iterations: len(samples)}
+	for n, sample := range samples {
+		durations[n] = sample.elapsed
+		total += sample.elapsed
+		result.SharedHitBlocks += sample.hit
+		result.SharedReadBlocks += sample.read
+		result.HasBuffers = result.HasBuffers || sample.hasBuffers
+	}
+	sort.Slice(durations, func(a, b int) bool { return durations[a] < durations[b] })
+
+	result.Min = durations[0]
+	result.Median = percentile(durations, 0.5)
+	result.P95 = percentile(durations, 0.95)
+	result.Max = durations[len(durations)-1]
+	result.Mean = total / time.Duration(len(samples))
+	result.SharedHitBlocks /= int64(len(samples))
+	result.SharedReadBlocks /= int64(len(samples))
+	return result
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// сохраняет итоги замера вместе с ревизией и настройками запуска
+func (q *QueryRunner) recordRun(ctx context.Context, runID string, stmt *statement, result BenchResult, options BenchOptions) error {
+	config, err := json.Marshal(struct {
+		BenchOptions
+		Params []interface{} `json:"params"`
+		AsOf   string        `json:"as_of,omitempty"`
+		Output string        `json:"output"`
+	}{options, stmt.args, q.asOf, stmt.output})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации настроек замера: %w", err)
+	}
+
+	var site, revision, hit, read interface{}
+	if q.site != "" {
+		site = q.site
+	}
+	if options.Revision != "" {
+		revision = options.Revision
+	}
+	if result.HasBuffers {
+		hit, read = result.SharedHitBlocks, result.SharedReadBlocks
+	}
+
+	_, err = q.db.ExecContext(ctx, `
+		INSERT INTO query_runs (
+			run_id, query, file, site, driver, git_revision, config, iterations,
+			min_ms, median_ms, p95_ms, max_ms, mean_ms, shared_hit_blocks, shared_read_blocks
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`, runID, result.Query, result.File, site, q.store.Driver(), revision, string(config), result.Iterations,
+		milliseconds(result.Min), milliseconds(result.Median), milliseconds(result.P95),
+		milliseconds(result.Max), milliseconds(result.Mean), hit, read)
+	if err != nil {
+		return fmt.Errorf("ошибка записи истории замеров: %w", err)
+	}
+	return nil
+}
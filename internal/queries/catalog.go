@@ -0,0 +1,294 @@
+package queries
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stackexchange-data-analysis/internal/database"
+)
+
+// аналитический запрос каталога. Метаданные задаются заголовком файла
+// из комментариев вида "-- ключ: значение":
+//
+//	-- name: q1
+//	-- description: Пары тегов и скорость ответов
+//	-- tags: tags, reputation
+//	-- runtime: 2s
+//	-- requires: posts, users, extract_tags
+//	-- param: min_pairs int = 2 Минимальное число вопросов с парой тегов
+//	-- format: json, csv
+//	-- writes: true
+//
+// Запрос выполняется в транзакции только для чтения, если заголовок writes
+// не разрешает изменение данных. Файлы без заголовка с name (например,
+// скрипты схемы) в каталог не попадают
+type Query struct {
+	Name        string
+	Description string
+	Tags        []string
+	// ожидаемое время выполнения; 0 — не задано
+	ExpectedRuntime time.Duration
+	// таблицы, представления и функции, без которых запрос не выполнить
+	Requires []string
+	// параметры запроса в порядке объявления
+	Params []Param
+	// форматы файлов результата; пустой список означает формат запуска
+	Formats []string
+	// запрос может изменять данные
+	AllowWrites bool
+	Path        string
+	// варианты запроса на диалектах хранилищ: q1.sqlite.sql для sqlite
+	dialects map[string]*Query
+}
+
+// For возвращает вариант запроса для драйвера хранилища, если он есть
+func (q *Query) For(driver string) *Query {
+	if variant, ok := q.dialects[driver]; ok {
+		return variant
+	}
+	return q
+}
+
+// Dialects возвращает драйверы, для которых есть отдельный вариант запроса
+func (q *Query) Dialects() []string {
+	drivers := make([]string, 0, len(q.dialects))
+	for driver := range q.dialects {
+		drivers = append(drivers, driver)
+	}
+	sort.Strings(drivers)
+	return drivers
+}
+
+func (q *Query) HasTag(tag string) bool {
+	for _, t := range q.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+type Catalog struct {
+	queries []*Query
+	byName  map[string]*Query
+}
+
+var headerLine = regexp.MustCompile(`^--\s*(name|description|tags|runtime|requires|param|format|writes)\s*:\s*(.*)$`)
+
+var dialectDrivers = []string{database.DriverPostgres, database.DriverSQLite}
+
+// LoadCatalog находит запросы с заголовком метаданных среди *.sql файлов директории
+func LoadCatalog(dir string) (*Catalog, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска файлов запросов: %w", err)
+	}
+	sort.Strings(files)
+
+	catalog := &Catalog{byName: make(map[string]*Query)}
+	var variants []*Query
+	variantDrivers := make(map[*Query]string)
+
+	for _, file := range files {
+		query, err := parseQueryFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if query == nil {
+			continue
+		}
+
+		if driver := fileDialect(file); driver != "" {
+			variants = append(variants, query)
+			variantDrivers[query] = driver
+			continue
+		}
+
+		if other, ok := catalog.byName[query.Name]; ok {
+			return nil, fmt.Errorf("запрос %s объявлен дважды: %s и %s", query.Name, other.Path, query.Path)
+		}
+		catalog.byName[query.Name] = query
+		catalog.queries = append(catalog.queries, query)
+	}
+
+	for _, variant := range variants {
+		base, ok := catalog.byName[variant.Name]
+		if !ok {
+			return nil, fmt.Errorf("для варианта %s нет основного запроса %s", variant.Path, variant.Name)
+		}
+		if variant.Description == "" {
+			variant.Description = base.Description
+		}
+		if len(variant.Tags) == 0 {
+			variant.Tags = base.Tags
+		}
+		if variant.ExpectedRuntime == 0 {
+			variant.ExpectedRuntime = base.ExpectedRuntime
+		}
+		if len(variant.Params) == 0 {
+			variant.Params = base.Params
+		}
+		if len(variant.Formats) == 0 {
+			variant.Formats = base.Formats
+		}
+		variant.AllowWrites = variant.AllowWrites || base.AllowWrites
+		if base.dialects == nil {
+			base.dialects = make(map[string]*Query)
+		}
+		base.dialects[variantDrivers[variant]] = variant
+	}
+
+	return catalog, nil
+}
+
+// драйвер варианта запроса по имени файла q1.<driver>.sql
+func fileDialect(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".sql")
+	for _, driver := range dialectDrivers {
+		if strings.HasSuffix(name, "."+driver) {
+			return driver
+		}
+	}
+	return ""
+}
+
+// читает заголовок из комментариев в начале файла; nil означает файл без метаданных
+func parseQueryFile(path string) (*Query, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть файл запроса: %w", err)
+	}
+	defer file.Close()
+
+	query := &Query{Path: path}
+	found := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		match := headerLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value := strings.TrimSpace(match[2])
+
+		switch match[1] {
+		case "name":
+			query.Name = value
+			found = true
+		case "description":
+			query.Description = value
+		case "tags":
+			query.Tags = splitHeaderList(value)
+		case "runtime":
+			runtime, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("неверное время выполнения %q в %s: %w", value, path, err)
+			}
+			query.ExpectedRuntime = runtime
+		case "requires":
+			query.Requires = splitHeaderList(value)
+		case "param":
+			param, err := parseParam(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			for _, declared := range query.Params {
+				if declared.Name == param.Name {
+					return nil, fmt.Errorf("параметр %s объявлен дважды в %s", param.Name, path)
+				}
+			}
+			query.Params = append(query.Params, param)
+		case "format":
+			query.Formats = splitHeaderList(value)
+			if err := CheckFormats(query.Formats); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		case "writes":
+			writes, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("неверное значение writes %q в %s, ожидается true или false", value, path)
+			}
+			query.AllowWrites = writes
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла запроса %s: %w", path, err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+	if query.Name == "" {
+		return nil, fmt.Errorf("пустое имя запроса в %s", path)
+	}
+	return query, nil
+}
+
+func splitHeaderList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Queries возвращает все запросы каталога в порядке имён файлов
+func (c *Catalog) Queries() []*Query {
+	return c.queries
+}
+
+func (c *Catalog) Get(name string) (*Query, error) {
+	query, ok := c.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("запрос %s не найден в каталоге", name)
+	}
+	return query, nil
+}
+
+// Select отбирает запросы по именам и тегу; без имён и тега возвращает весь каталог.
+// Имена сохраняют указанный порядок, тег дополнительно фильтрует результат
+func (c *Catalog) Select(names []string, tag string) ([]*Query, error) {
+	selected := c.queries
+	if len(names) > 0 {
+		selected = make([]*Query, 0, len(names))
+		for _, name := range names {
+			query, err := c.Get(name)
+			if err != nil {
+				return nil, err
+			}
+			selected = append(selected, query)
+		}
+	}
+
+	if tag == "" {
+		return selected, nil
+	}
+
+	var tagged []*Query
+	for _, query := range selected {
+		if query.HasTag(tag) {
+			tagged = append(tagged, query)
+		}
+	}
+	if len(tagged) == 0 {
+		return nil, fmt.Errorf("нет запросов с тегом %s", tag)
+	}
+	return tagged, nil
+}
@@ -0,0 +1,491 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/database"
+	"stackexchange-data-analysis/internal/explain"
+	"stackexchange-data-analysis/internal/sqlscript"
+)
+
+// индекс-кандидат из файла кандидатов:
+//
+//	-- составной индекс для выборки ответов автора
+//	CREATE INDEX idx_lab_posts_owner_created ON posts (owner_user_id, creation_date);
+type IndexCandidate struct {
+	// имя из определения, возможно со схемой: по нему индекс удаляется
+	Name       string
+	Definition string
+}
+
+// имя индекса без схемы, как его называют планы запросов
+func (c IndexCandidate) planName() string {
+	return c.Name[strings.LastIndexByte(c.Name, '.')+1:]
+}
+
+var createIndexStatement = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s+ON\s`)
+
+// LoadIndexCandidates читает определения CREATE INDEX, разделённые точкой с запятой.
+// У каждого индекса должно быть имя: по нему индекс удаляется после замера
+func LoadIndexCandidates(path string) ([]IndexCandidate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл кандидатов: %w", err)
+	}
+
+	statements, err := sqlscript.Split(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var candidates []IndexCandidate
+	seen := make(map[string]bool)
+	for _, stmt := range statements {
+		match := createIndexStatement.FindStringSubmatch(stmt.Text)
+		if stmt.Kind != sqlscript.KindDDL || match == nil {
+			return nil, fmt.Errorf("%s: строка %d: ожидается CREATE INDEX <имя> ON ..., получено %q", path, stmt.Line, stmt.Text)
+		}
+		if seen[match[1]] {
+			return nil, fmt.Errorf("%s: строка %d: индекс %s объявлен дважды", path, stmt.Line, match[1])
+		}
+		seen[match[1]] = true
+		candidates = append(candidates, IndexCandidate{Name: match[1], Definition: stmt.Text})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("в файле %s нет индексов-кандидатов", path)
+	}
+	return candidates, nil
+}
+
+// параметры эксперимента с индексами
+type IndexLabOptions struct {
+	// наибольшее число кандидатов, создаваемых вместе; 1 — каждый по отдельности
+	MaxCombination int
+	// число выполнений запроса в каждом замере после прогревочного;
+	// берётся медиана времени
+	Runs int
+	// наименьшее сокращение суммарного времени запросов (%), при котором
+	// набор индексов рекомендуется
+	MinGain float64
+}
+
+// замер одного запроса; стоимость планировщика есть только в Postgres
+type indexMeasure struct {
+	Query string
+	Cost  float64
+	Time  time.Duration
+	Used  []string
+}
+
+// замер запросов с набором индексов; пустой набор — исходная схема
+type indexTrial struct {
+	Indexes   []string
+	BuildTime time.Duration
+	Size      int64
+	Measures  []indexMeasure
+}
+
+func (t *indexTrial) total() time.Duration {
+	var total time.Duration
+	for _, measure := range t.Measures {
+		total += measure.Time
+	}
+	return total
+}
+
+// индексы набора, которые не выбрал ни один план
+func (t *indexTrial) unused() []string {
+	used := make(map[string]bool)
+	for _, measure := range t.Measures {
+		for _, name := range measure.Used {
+			used[name] = true
+		}
+	}
+	var unused []string
+	for _, name := range t.Indexes {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+// IndexReport — итоги эксперимента: наборы индексов по убыванию выигрыша
+// и замеры каждого запроса
+type IndexReport struct {
+	Ranking *ResultSet
+	Queries *ResultSet
+}
+
+// IndexLab создаёт каждый набор индексов-кандидатов, выполняет запросы
+// с EXPLAIN ANALYZE, удаляет индексы и ранжирует наборы по сокращению
+// суммарного времени запросов относительно исходной схемы
+func (q *QueryRunner) IndexLab(queries []*Query, candidates []IndexCandidate, options IndexLabOptions) (*IndexReport, error) {
+	if options.Runs <= 0 {
+		options.Runs = 3
+	}
+	if options.MaxCombination <= 0 {
+		options.MaxCombination = 1
+	}
+	if options.MaxCombination > len(candidates) {
+		options.MaxCombination = len(candidates)
+	}
+	if q.params != nil {
+		if err := q.params.Check(queries); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	for _, candidate := range candidates {
+		exists, err := q.store.HasObject(ctx, candidate.Name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("индекс %s уже есть в базе; эксперимент удаляет индексы-кандидаты, выберите другое имя", candidate.Name)
+		}
+	}
+
+	var (
+		stmts []*statement
+		names []string
+	)
+	for _, query := range queries {
+		query = query.For(q.store.Driver())
+
+		missing, err := q.MissingObjects(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			q.logger.Warn("в базе нет объектов, нужных запросу, пропускаем",
+				zap.String("query", query.Name),
+				zap.Strings("missing", missing))
+			continue
+		}
+
+		stmt, err := q.prepare(query)
+		if err != nil {
+			return nil, err
+		}
+		if !stmt.returnsRows() {
+			return nil, fmt.Errorf("%s: строка %d: EXPLAIN неприменим к оператору вида %s без строк результата", stmt.path, stmt.line, stmt.kind)
+		}
+		stmts = append(stmts, stmt)
+		names = append(names, query.Name)
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("нет запросов для эксперимента")
+	}
+
+	q.logger.Info("замер запросов без индексов-кандидатов", zap.Int("queries", len(stmts)))
+	baseline := &indexTrial{}
+	if err := q.measureTrial(ctx, baseline, stmts, names, candidates, options.Runs); err != nil {
+		return nil, err
+	}
+
+	var trials []*indexTrial
+	for size := 1; size <= options.MaxCombination; size++ {
+		for _, combination := range combinations(len(candidates), size) {
+			set := make([]IndexCandidate, len(combination))
+			for n, index := range combination {
+				set[n] = candidates[index]
+			}
+
+			trial, err := q.runIndexTrial(ctx, set, stmts, names, candidates, options.Runs)
+			if err != nil {
+				return nil, err
+			}
+			trials = append(trials, trial)
+		}
+	}
+
+	return buildIndexReport(baseline, trials, options.MinGain), nil
+}
+
+// создаёт набор индексов, замеряет запросы и удаляет индексы, даже если замер не удался
+func (q *QueryRunner) runIndexTrial(ctx context.Context, set []IndexCandidate, stmts []*statement, names []string, candidates []IndexCandidate, runs int) (trial *indexTrial, err error) {
+	trial = &indexTrial{}
+	for _, candidate := range set {
+		trial.Indexes = append(trial.Indexes, candidate.Name)
+	}
+	q.logger.Info("замер набора индексов", zap.Strings("indexes", trial.Indexes))
+
+	var created []string
+	defer func() {
+		for _, name := range created {
+			if _, dropErr := q.db.ExecContext(context.Background(), "DROP INDEX IF EXISTS "+name); dropErr != nil && err == nil {
+				err = fmt.Errorf("ошибка удаления индекса %s: %w", name, dropErr)
+			}
+		}
+	}()
+
+	for _, candidate := range set {
+		started := time.Now()
+		if _, err := q.db.ExecContext(ctx, candidate.Definition); err != nil {
+			return nil, fmt.Errorf("ошибка создания индекса %s: %w", candidate.Name, err)
+		}
+		trial.BuildTime += time.Since(started)
+		created = append(created, candidate.Name)
+
+		size, err := q.store.RelationSize(ctx, candidate.Name)
+		if err != nil {
+			return nil, err
+		}
+		trial.Size += size
+	}
+
+	if err := q.measureTrial(ctx, trial, stmts, names, candidates, runs); err != nil {
+		return nil, err
+	}
+	return trial, nil
+}
+
+func (q *QueryRunner) measureTrial(ctx context.Context, trial *indexTrial, stmts []*statement, names []string, candidates []IndexCandidate, runs int) error {
+	for n, stmt := range stmts {
+		measure, err := q.measureQuery(ctx, stmt, candidates, runs)
+		if err != nil {
+			return fmt.Errorf("ошибка замера запроса %s: %w", names[n], err)
+		}
+		measure.Query = names[n]
+		trial.Measures = append(trial.Measures, measure)
+	}
+	return nil
+}
+
+// выполняет запрос runs раз и запоминает медиану времени, стоимость
+// и индексы-кандидаты, выбранные планировщиком. Первое выполнение прогревает
+// кэш и не учитывается: иначе замер без индексов, идущий первым, платит за
+// холодный кэш, а выигрыш наборов индексов завышается
+func (q *QueryRunner) measureQuery(ctx context.Context, stmt *statement, candidates []IndexCandidate, runs int) (indexMeasure, error) {
+	conn, err := q.siteConn(ctx)
+	if err != nil {
+		return indexMeasure{}, err
+	}
+	defer conn.Close()
+
+	var measure indexMeasure
+	durations := make([]time.Duration, 0, runs)
+	for n := 0; n <= runs; n++ {
+		// EXPLAIN ANALYZE выполняет запрос: каждое выполнение откатывается
+		tx, err := q.beginQuery(ctx, conn, stmt)
+		if err != nil {
+			return indexMeasure{}, err
+		}
+
+		var (
+			elapsed time.Duration
+			used    []string
+		)
+		if q.store.Driver() == database.DriverPostgres {
+			elapsed, measure.Cost, used, err = explainIndexPostgres(ctx, tx, stmt, candidates)
+		} else {
+			elapsed, used, err = explainIndexSQLite(ctx, tx, stmt, candidates)
+		}
+		tx.Rollback()
+		if err != nil {
+			return indexMeasure{}, err
+		}
+		if n == 0 {
+			continue
+		}
+		durations = append(durations, elapsed)
+		measure.Used = used
+	}
+
+	sort.Slice(durations, func(a, b int) bool { return durations[a] < durations[b] })
+	measure.Time = percentile(durations, 0.5)
+	return measure, nil
+}
+
+// время выполнения и стоимость по плану EXPLAIN ANALYZE
+func explainIndexPostgres(ctx context.Context, tx *queryTx, stmt *statement, candidates []IndexCandidate) (time.Duration, float64, []string, error) {
+	var planJSON []byte
+	if err := tx.QueryRowContext(ctx, explain.Prefix+stmt.text, stmt.args...).Scan(&planJSON); err != nil {
+		return 0, 0, nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	plan, err := explain.Parse(planJSON)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	var used []string
+	plan.Walk(func(path string, node *explain.Node) {
+		for _, candidate := range candidates {
+			if node.IndexName == candidate.planName() {
+				used = append(used, candidate.Name)
+			}
+		}
+	})
+
+	elapsed := time.Duration(plan.ExecutionTime * float64(time.Millisecond))
+	return elapsed, plan.Root.TotalCost, used, nil
+}
+
+// в SQLite нет EXPLAIN ANALYZE: время замеряется выполнением запроса,
+// а выбранные индексы читаются из EXPLAIN QUERY PLAN
+func explainIndexSQLite(ctx context.Context, tx *queryTx, stmt *statement, candidates []IndexCandidate) (time.Duration, []string, error) {
+	rows, err := tx.QueryContext(ctx, "EXPLAIN QUERY PLAN "+stmt.text, stmt.args...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка выполнения EXPLAIN QUERY PLAN: %w", err)
+	}
+	var used []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("ошибка сканирования результата: %w", err)
+		}
+		for _, candidate := range candidates {
+			if strings.Contains(detail, "INDEX "+candidate.planName()+" ") || strings.HasSuffix(detail, "INDEX "+candidate.planName()) {
+				used = append(used, candidate.Name)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	sample, err := benchRows(ctx, tx, stmt)
+	if err != nil {
+		return 0, nil, err
+	}
+	return sample.elapsed, used, nil
+}
+
+// все сочетания из n по k в лексикографическом порядке
+func combinations(n, k int) [][]int {
+	var result [][]int
+	current := make([]int, 0, k)
+	var next func(start int)
+	next = func(start int) {
+		if len(current) == k {
+			result = append(result, append([]int(nil), current...))
+			return
+		}
+		for i := start; i < n; i++ {
+			current = append(current, i)
+			next(i + 1)
+			current = current[:len(current)-1]
+		}
+	}
+	next(0)
+	return result
+}
+
+// ранжирует наборы по сокращению суммарного времени, при равенстве —
+// по размеру индексов
+func buildIndexReport(baseline *indexTrial, trials []*indexTrial, minGain float64) *IndexReport {
+	baseTotal := baseline.total()
+	saved := func(trial *indexTrial) time.Duration { return baseTotal - trial.total() }
+	sort.SliceStable(trials, func(a, b int) bool {
+		if saved(trials[a]) != saved(trials[b]) {
+			return saved(trials[a]) > saved(trials[b])
+		}
+		return trials[a].Size < trials[b].Size
+	})
+
+	ranking := &ResultSet{
+		Name: "index-lab",
+		Columns: []Column{
+			{Name: "rank", Type: "INTEGER"},
+			{Name: "indexes", Type: "TEXT"},
+			{Name: "size_bytes", Type: "BIGINT"},
+			{Name: "build_ms", Type: "DOUBLE PRECISION"},
+			{Name: "total_ms", Type: "DOUBLE PRECISION"},
+			{Name: "baseline_ms", Type: "DOUBLE PRECISION"},
+			{Name: "saved_pct", Type: "DOUBLE PRECISION"},
+			{Name: "recommendation", Type: "TEXT"},
+		},
+	}
+	for n, trial := range trials {
+		gain := 0.0
+		if baseTotal > 0 {
+			gain = 100 * float64(saved(trial)) / float64(baseTotal)
+		}
+
+		recommendation := "рекомендуется"
+		if unused := trial.unused(); len(unused) > 0 {
+			recommendation = "не используется планами: " + strings.Join(unused, ", ")
+		} else if gain < minGain {
+			recommendation = "нет заметного выигрыша"
+		}
+
+		ranking.Rows = append(ranking.Rows, []interface{}{
+			int64(n + 1),
+			strings.Join(trial.Indexes, " + "),
+			trial.Size,
+			roundMilliseconds(trial.BuildTime),
+			roundMilliseconds(trial.total()),
+			roundMilliseconds(baseTotal),
+			float64(int64(gain*10)) / 10,
+			recommendation,
+		})
+	}
+
+	detail := &ResultSet{
+		Name: "index-lab.queries",
+		Columns: []Column{
+			{Name: "indexes", Type: "TEXT"},
+			{Name: "query", Type: "TEXT"},
+			{Name: "cost", Type: "DOUBLE PRECISION"},
+			{Name: "baseline_cost", Type: "DOUBLE PRECISION"},
+			{Name: "time_ms", Type: "DOUBLE PRECISION"},
+			{Name: "baseline_ms", Type: "DOUBLE PRECISION"},
+			{Name: "used_indexes", Type: "TEXT"},
+		},
+	}
+	for _, trial := range trials {
+		for n, measure := range trial.Measures {
+			base := baseline.Measures[n]
+			var cost, baseCost interface{}
+			if measure.Cost > 0 {
+				cost, baseCost = measure.Cost, base.Cost
+			}
+			detail.Rows = append(detail.Rows, []interface{}{
+				strings.Join(trial.Indexes, " + "),
+				measure.Query,
+				cost,
+				baseCost,
+				roundMilliseconds(measure.Time),
+				roundMilliseconds(base.Time),
+				strings.Join(measure.Used, ", "),
+			})
+		}
+	}
+
+	return &IndexReport{Ranking: ranking, Queries: detail}
+}
+
+func roundMilliseconds(d time.Duration) float64 {
+	return float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+}
+
+// WriteIndexReport записывает рейтинг и замеры запросов в форматах запуска;
+// по умолчанию Markdown и JSON
+func (q *QueryRunner) WriteIndexReport(report *IndexReport, outputDir string) ([]string, error) {
+	formats := q.formats
+	if len(formats) == 0 {
+		formats = []string{FormatMarkdown, FormatJSON}
+	}
+
+	var outputs []string
+	for _, results := range []*ResultSet{report.Ranking, report.Queries} {
+		written, err := writeResults(results, outputDir, formats)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, written...)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,324 @@
+package queries
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// типы параметров запроса
+const (
+	ParamInt    = "int"
+	ParamFloat  = "float"
+	ParamString = "string"
+	ParamBool   = "bool"
+	ParamDate   = "date"
+)
+
+// параметр запроса из заголовка:
+//
+//	-- param: min_pairs int = 2 Минимальное число вопросов с парой тегов
+//
+// Параметр без значения по умолчанию обязателен. В тексте запроса на него
+// ссылаются как :min_pairs, при выполнении ссылки заменяются плейсхолдерами
+type Param struct {
+	Name        string
+	Type        string
+	Default     string
+	HasDefault  bool
+	Description string
+}
+
+var paramDeclaration = regexp.MustCompile(`^([a-z_][a-z0-9_]*)\s+(int|float|string|bool|date)(?:\s*=\s*("[^"]*"|\S+))?(?:\s+(.*))?$`)
+
+func parseParam(value string) (Param, error) {
+	match := paramDeclaration.FindStringSubmatch(value)
+	if match == nil {
+		return Param{}, fmt.Errorf("неверное объявление параметра %q, ожидается: имя тип [= значение] [описание]", value)
+	}
+
+	param := Param{
+		Name:        match[1],
+		Type:        match[2],
+		Description: strings.TrimSpace(match[4]),
+	}
+	if match[3] != "" {
+		param.Default = strings.Trim(match[3], `"`)
+		param.HasDefault = true
+		if _, err := param.convert(param.Default); err != nil {
+			return Param{}, err
+		}
+	}
+	return param, nil
+}
+
+// convert приводит строковое значение к типу параметра
+func (p Param) convert(value string) (interface{}, error) {
+	var (
+		converted interface{}
+		err       error
+	)
+	switch p.Type {
+	case ParamInt:
+		converted, err = strconv.ParseInt(value, 10, 64)
+	case ParamFloat:
+		converted, err = strconv.ParseFloat(value, 64)
+	case ParamBool:
+		converted, err = strconv.ParseBool(value)
+	case ParamDate:
+		converted, err = time.Parse("2006-01-02", value)
+	default:
+		converted = value
+	}
+	if err != nil {
+		return nil, fmt.Errorf("неверное значение %q параметра %s типа %s", value, p.Name, p.Type)
+	}
+	return converted, nil
+}
+
+// Params — значения параметров запуска: общие для всех запросов и отдельные
+// для запросов каталога. Значения запроса важнее общих
+type Params struct {
+	Global   map[string]string
+	PerQuery map[string]map[string]string
+}
+
+func NewParams() *Params {
+	return &Params{
+		Global:   make(map[string]string),
+		PerQuery: make(map[string]map[string]string),
+	}
+}
+
+func (p *Params) String() string {
+	if p == nil {
+		return ""
+	}
+	var assignments []string
+	for name, value := range p.Global {
+		assignments = append(assignments, name+"="+value)
+	}
+	for query, values := range p.PerQuery {
+		for name, value := range values {
+			assignments = append(assignments, query+"."+name+"="+value)
+		}
+	}
+	sort.Strings(assignments)
+	return strings.Join(assignments, ",")
+}
+
+// Set разбирает значение из командной строки: имя=значение или запрос.имя=значение
+func (p *Params) Set(assignment string) error {
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("неверный параметр %q, ожидается имя=значение", assignment)
+	}
+
+	if query, param, ok := strings.Cut(name, "."); ok {
+		if p.PerQuery[query] == nil {
+			p.PerQuery[query] = make(map[string]string)
+		}
+		p.PerQuery[query][param] = value
+		return nil
+	}
+	p.Global[name] = value
+	return nil
+}
+
+// файл запуска (yaml):
+//
+//	params:
+//	  limit: 50
+//	queries:
+//	  q1:
+//	    min_pairs: 5
+type runFile struct {
+	Params  map[string]interface{}
+	Queries map[string]map[string]interface{}
+}
+
+// LoadRunFile добавляет значения параметров из yaml файла запуска; значения,
+// уже заданные в командной строке, сохраняются
+func (p *Params) LoadRunFile(path string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("ошибка чтения файла запуска: %w", err)
+	}
+
+	var file runFile
+	if err := v.Unmarshal(&file); err != nil {
+		return fmt.Errorf("ошибка парсинга файла запуска: %w", err)
+	}
+
+	for name, value := range file.Params {
+		if _, ok := p.Global[name]; !ok {
+			p.Global[name] = fmt.Sprint(value)
+		}
+	}
+	for query, values := range file.Queries {
+		if p.PerQuery[query] == nil {
+			p.PerQuery[query] = make(map[string]string)
+		}
+		for name, value := range values {
+			if _, ok := p.PerQuery[query][name]; !ok {
+				p.PerQuery[query][name] = fmt.Sprint(value)
+			}
+		}
+	}
+	return nil
+}
+
+// Check проверяет, что каждый заданный параметр объявлен хотя бы одним из запросов
+func (p *Params) Check(queries []*Query) error {
+	declared := make(map[string]bool)
+	for _, query := range queries {
+		for _, param := range query.Params {
+			declared[param.Name] = true
+			declared[query.Name+"."+param.Name] = true
+		}
+	}
+
+	var unknown []string
+	for name := range p.Global {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	for query, values := range p.PerQuery {
+		for name := range values {
+			if !declared[query+"."+name] {
+				unknown = append(unknown, query+"."+name)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("параметры не объявлены в выбранных запросах: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// значение параметра для запроса: из параметров запроса, общих или по умолчанию;
+// set сообщает, что значение задано явно
+func (p *Params) lookup(query string, param Param) (value string, set bool) {
+	if p != nil {
+		if value, ok := p.PerQuery[query][param.Name]; ok {
+			return value, true
+		}
+		if value, ok := p.Global[param.Name]; ok {
+			return value, true
+		}
+	}
+	return param.Default, false
+}
+
+// привязанный набор параметров: значения плейсхолдеров по порядку
+// и суффикс имени файлов результата
+type binding struct {
+	args   []interface{}
+	suffix string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// bind заменяет ссылки :имя на плейсхолдеры $N. Параметры, отличные от
+// значений по умолчанию, записываются в суффикс имени файлов результата
+func bind(query *Query, text string, params *Params) (string, binding, error) {
+	var result binding
+	values := make(map[string]interface{})
+	var changed []string
+
+	for _, param := range query.Params {
+		value, set := params.lookup(query.Name, param)
+		if !set && !param.HasDefault {
+			return "", result, fmt.Errorf("не задан обязательный параметр %s запроса %s", param.Name, query.Name)
+		}
+		converted, err := param.convert(value)
+		if err != nil {
+			return "", result, err
+		}
+
+		values[param.Name] = converted
+		if set && (!param.HasDefault || value != param.Default) {
+			changed = append(changed, param.Name+"="+unsafeFileChars.ReplaceAllString(value, "_"))
+		}
+	}
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		result.suffix = "." + strings.Join(changed, ".")
+	}
+	text, result.args = replaceParamRefs(text, values)
+	return text, result, nil
+}
+
+// заменяет :имя объявленных параметров плейсхолдерами в порядке первого
+// упоминания, пропуская строки, идентификаторы в кавычках, комментарии
+// и приведения типов ::. Возвращает значения плейсхолдеров по порядку
+func replaceParamRefs(text string, values map[string]interface{}) (string, []interface{}) {
+	var args []interface{}
+	positions := make(map[string]int)
+	var out strings.Builder
+	for n := 0; n < len(text); {
+		c := text[n]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(text[n+1:], c)
+			if end < 0 {
+				out.WriteString(text[n:])
+				return out.String(), args
+			}
+			out.WriteString(text[n : n+end+2])
+			n += end + 2
+		case strings.HasPrefix(text[n:], "--"):
+			end := strings.IndexByte(text[n:], '\n')
+			if end < 0 {
+				out.WriteString(text[n:])
+				return out.String(), args
+			}
+			out.WriteString(text[n : n+end])
+			n += end
+		case strings.HasPrefix(text[n:], "/*"):
+			end := strings.Index(text[n+2:], "*/")
+			if end < 0 {
+				out.WriteString(text[n:])
+				return out.String(), args
+			}
+			out.WriteString(text[n : n+end+4])
+			n += end + 4
+		case strings.HasPrefix(text[n:], "::"):
+			out.WriteString("::")
+			n += 2
+		case c == ':':
+			end := n + 1
+			for end < len(text) && isIdentChar(text[end]) {
+				end++
+			}
+			name := text[n+1 : end]
+			if value, ok := values[name]; ok {
+				if _, ok := positions[name]; !ok {
+					args = append(args, value)
+					positions[name] = len(args)
+				}
+				fmt.Fprintf(&out, "$%d", positions[name])
+			} else {
+				out.WriteString(text[n:end])
+			}
+			n = end
+		default:
+			out.WriteByte(c)
+			n++
+		}
+	}
+	return out.String(), args
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,131 @@
+package queries
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplaceParamRefs(t *testing.T) {
+	values := map[string]interface{}{"limit": int64(10), "tag": "sql"}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+		args []interface{}
+	}{
+		{
+			name: "ссылки по порядку первого упоминания",
+			text: "SELECT * FROM posts WHERE tags = :tag LIMIT :limit",
+			want: "SELECT * FROM posts WHERE tags = $1 LIMIT $2",
+			args: []interface{}{"sql", int64(10)},
+		},
+		{
+			name: "повторная ссылка получает тот же плейсхолдер",
+			text: "SELECT :limit, :limit + 1",
+			want: "SELECT $1, $1 + 1",
+			args: []interface{}{int64(10)},
+		},
+		{
+			name: "приведение типа",
+			text: "SELECT score::float, :limit::bigint",
+			want: "SELECT score::float, $1::bigint",
+			args: []interface{}{int64(10)},
+		},
+		{
+			name: "строковый литерал",
+			text: "SELECT ':tag', 'it''s :limit' WHERE x = :tag",
+			want: "SELECT ':tag', 'it''s :limit' WHERE x = $1",
+			args: []interface{}{"sql"},
+		},
+		{
+			name: "идентификатор в кавычках",
+			text: `SELECT "a:tag" FROM t`,
+			want: `SELECT "a:tag" FROM t`,
+		},
+		{
+			name: "однострочный комментарий",
+			text: "SELECT 1 -- :limit\nLIMIT :limit",
+			want: "SELECT 1 -- :limit\nLIMIT $1",
+			args: []interface{}{int64(10)},
+		},
+		{
+			name: "многострочный комментарий",
+			text: "SELECT /* :tag\n:limit */ :tag",
+			want: "SELECT /* :tag\n:limit */ $1",
+			args: []interface{}{"sql"},
+		},
+		{
+			name: "необъявленный параметр остаётся как есть",
+			text: "SELECT :other, :tag",
+			want: "SELECT :other, $1",
+			args: []interface{}{"sql"},
+		},
+		{
+			name: "незакрытая строка",
+			text: "SELECT :tag, 'abc :limit",
+			want: "SELECT $1, 'abc :limit",
+			args: []interface{}{"sql"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := replaceParamRefs(tt.text, values)
+			if got != tt.want {
+				t.Errorf("текст:\n%s\nожидается:\n%s", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("значения %v, ожидается %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Param
+		wantErr bool
+	}{
+		{
+			value: "min_pairs int = 2 Минимальное число вопросов",
+			want:  Param{Name: "min_pairs", Type: ParamInt, Default: "2", HasDefault: true, Description: "Минимальное число вопросов"},
+		},
+		{
+			value: `title string = "two words" Заголовок`,
+			want:  Param{Name: "title", Type: ParamString, Default: "two words", HasDefault: true, Description: "Заголовок"},
+		},
+		{
+			value: "since date Начало периода",
+			want:  Param{Name: "since", Type: ParamDate, Description: "Начало периода"},
+		},
+		{
+			value: "ratio float=0.5",
+			want:  Param{Name: "ratio", Type: ParamFloat, Default: "0.5", HasDefault: true},
+		},
+		{value: "limit integer = 5", wantErr: true},
+		{value: "Limit int", wantErr: true},
+		{value: "limit int = abc", wantErr: true},
+		{value: "since date = 2020-13-01", wantErr: true},
+		{value: "flag bool = maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseParam(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ожидается ошибка, получено %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("получено %+v, ожидается %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package queries
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/explain"
+)
+
+// сравнение планов запросов с базовыми
+type PlanOptions struct {
+	// директория базовых планов <имя>.plan.json; пустая строка отключает сравнение
+	BaselineDir string
+	// заменить базовые планы текущими вместо поиска регрессий
+	UpdateBaseline bool
+	Thresholds     explain.Thresholds
+}
+
+// сравнивает план запроса с базовым и возвращает найденные регрессии.
+// Если базового плана ещё нет, текущий план сохраняется как базовый
+func (q *QueryRunner) checkPlan(stmt *statement, plan *explain.Plan) ([]explain.Regression, error) {
+	if q.plans.BaselineDir == "" {
+		return nil, nil
+	}
+
+	baselinePath := filepath.Join(q.plans.BaselineDir, stmt.output+".plan.json")
+	data, err := os.ReadFile(baselinePath)
+	if os.IsNotExist(err) || q.plans.UpdateBaseline {
+		return nil, q.saveBaseline(baselinePath, plan)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения базового плана: %w", err)
+	}
+
+	baseline, err := explain.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", baselinePath, err)
+	}
+
+	regressions := explain.Compare(baseline, plan, q.plans.Thresholds)
+	for _, regression := range regressions {
+		q.logger.Warn("регрессия плана запроса",
+			zap.String("file", stmt.path),
+			zap.String("kind", regression.Kind),
+			zap.String("node", regression.Path),
+			zap.String("detail", regression.Message))
+	}
+	if len(regressions) == 0 {
+		q.logger.Info("план запроса совпадает с базовым",
+			zap.String("file", stmt.path),
+			zap.Float64("execution_ms", plan.ExecutionTime),
+			zap.Float64("baseline_ms", baseline.ExecutionTime))
+	}
+	return regressions, nil
+}
+
+func (q *QueryRunner) saveBaseline(path string, plan *explain.Plan) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("не удалось создать директорию базовых планов: %w", err)
+	}
+
+	data, err := json.MarshalIndent([]*explain.Plan{plan}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации плана: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("не удалось записать базовый план: %w", err)
+	}
+
+	q.logger.Info("базовый план запроса сохранён", zap.String("file", path))
+	return nil
+}
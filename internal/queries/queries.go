@@ -1,264 +1,748 @@
 package queries
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
+	"stackexchange-data-analysis/internal/database"
+	"stackexchange-data-analysis/internal/explain"
+	"stackexchange-data-analysis/internal/sqlscript"
 )
 
 type QueryRunner struct {
-	db     *sqlx.DB
-	logger *zap.Logger
+	store database.Store
+	db    *sqlx.DB
+	site  string
+	asOf  string
+	// значения параметров запросов каталога
+	params *Params
+	// форматы результатов запуска; важнее форматов из заголовков запросов
+	formats []string
+	plans   PlanOptions
+	// auto_explain не загрузился: план запроса снимается отдельным выполнением
+	noAutoExplain bool
+	logger        *zap.Logger
 }
 
-func NewQueryRunner(db *sqlx.DB, logger *zap.Logger) *QueryRunner {
+// site ограничивает анализ одним сайтом; пустая строка означает все сайты.
+// asOf выбирает снимок: дата (ГГГГ-ММ-ДД) или dump_id; пустая строка означает
+// текущие данные. params задаёт значения параметров запросов; nil означает
+// значения по умолчанию. formats выбирает форматы файлов результата; пустой
+// список означает форматы из заголовков запросов или JSON
+func NewQueryRunner(store database.Store, site, asOf string, params *Params, formats []string, plans PlanOptions, logger *zap.Logger) *QueryRunner {
 	return &QueryRunner{
-		db:     db,
-		logger: logger,
+		store:   store,
+		db:      store.DB(),
+		site:    site,
+		asOf:    asOf,
+		params:  params,
+		formats: formats,
+		plans:   plans,
+		logger:  logger,
 	}
 }
 
-func (q *QueryRunner) ExecuteQuery(queryFilePath, outputDir string) error {
-	q.logger.Info("выполнение запроса", zap.String("file", queryFilePath))
+// возвращает соединение, в сессии которого выбран анализируемый сайт;
+// запросы читают его через функцию current_site(). При выбранном снимке
+// таблицы подменяются представлениями схемы as_of на его дату
+func (q *QueryRunner) siteConn(ctx context.Context) (*sqlx.Conn, error) {
+	if q.asOf != "" && q.store.Driver() != database.DriverPostgres {
+		return nil, fmt.Errorf("запросы на снимке (--as-of) поддерживаются только в Postgres")
+	}
 
-	queryBytes, err := os.ReadFile(queryFilePath)
+	conn, err := q.store.SessionConn(ctx, q.site)
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл запроса: %w", err)
+		return nil, err
 	}
 
-	queryText := string(queryBytes)
-	queryText = stripExplainAnalyze(queryText)
+	if q.asOf != "" {
+		if err := q.selectSnapshot(ctx, conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 
-	queryName := filepath.Base(queryFilePath)
+	return conn, nil
+}
+
+// выбирает снимок на дату asOf; номер дампа заменяется его датой
+func (q *QueryRunner) selectSnapshot(ctx context.Context, conn *sqlx.Conn) error {
+	asOf := q.asOf
+	if dumpID, err := strconv.Atoi(asOf); err == nil {
+		if err := conn.GetContext(ctx, &asOf,
+			"SELECT dump_date::text FROM dumps WHERE dump_id = $1", dumpID); err != nil {
+			return fmt.Errorf("дамп %d не найден: %w", dumpID, err)
+		}
+	} else if _, err := time.Parse("2006-01-02", asOf); err != nil {
+		return fmt.Errorf("неверное значение --as-of %q, ожидается дата ГГГГ-ММ-ДД или dump_id", asOf)
+	}
 
-	rows, err := q.db.Queryx(queryText)
+	var dumps int
+	err := conn.GetContext(ctx, &dumps, `
+		SELECT count(*) FROM dumps
+		WHERE dump_date <= $1 AND (current_site() IS NULL OR site = current_site())
+	`, asOf)
 	if err != nil {
-		return fmt.Errorf("ошибка выполнения запроса: %w", err)
+		return fmt.Errorf("ошибка чтения списка дампов: %w", err)
+	}
+	if dumps == 0 {
+		return fmt.Errorf("нет снимков на дату %s", asOf)
 	}
-	defer rows.Close()
 
-	var results []map[string]interface{}
-	for rows.Next() {
-		result := make(map[string]interface{})
-		if err := rows.MapScan(result); err != nil {
-			return fmt.Errorf("ошибка сканирования результатов: %w", err)
+	_, err = conn.ExecContext(ctx, `
+		SELECT set_config('app.as_of', $1, false),
+		       set_config('search_path', 'as_of, ' || current_setting('search_path'), false)
+	`, asOf)
+	if err != nil {
+		return fmt.Errorf("ошибка выбора снимка: %w", err)
+	}
+	return nil
+}
+
+// транзакция выполнения запроса. Если запрос не разрешает запись, транзакция
+// только для чтения: в Postgres SET TRANSACTION READ ONLY, в SQLite на время
+// транзакции включается query_only
+type queryTx struct {
+	*sqlx.Tx
+	conn      *sqlx.Conn
+	queryOnly bool
+}
+
+// beginQuery начинает транзакцию запроса и выполняет в ней операторы файла
+// перед последним
+func (q *QueryRunner) beginQuery(ctx context.Context, conn *sqlx.Conn, stmt *statement) (*queryTx, error) {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	qtx := &queryTx{Tx: tx, conn: conn}
+
+	if !stmt.writes {
+		readOnly := "SET TRANSACTION READ ONLY"
+		if q.store.Driver() == database.DriverSQLite {
+			readOnly = "PRAGMA query_only = ON"
+			qtx.queryOnly = true
 		}
-		for k, v := range result {
-			if b, ok := v.([]byte); ok {
-				result[k] = string(b)
-			}
+		if _, err := tx.ExecContext(ctx, readOnly); err != nil {
+			qtx.Rollback()
+			return nil, fmt.Errorf("ошибка перехода в режим только для чтения: %w", err)
 		}
+	}
 
-		results = append(results, result)
+	if err := sqlscript.ExecStatements(ctx, tx, stmt.setup); err != nil {
+		qtx.Rollback()
+		return nil, fmt.Errorf("%s: %w", stmt.path, err)
 	}
+	return qtx, nil
+}
 
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("не удалось создать директорию для результатов: %w", err)
+// query_only действует на соединение, а не на транзакцию, поэтому снимается
+// после её завершения
+func (t *queryTx) finish(err error) error {
+	if t.queryOnly {
+		t.conn.ExecContext(context.Background(), "PRAGMA query_only = OFF")
+		t.queryOnly = false
+	}
+	return err
+}
+
+func (t *queryTx) Commit() error {
+	return t.finish(t.Tx.Commit())
+}
+
+func (t *queryTx) Rollback() error {
+	return t.finish(t.Tx.Rollback())
+}
+
+// запрос, подготовленный к выполнению. Результат и план даёт последний
+// оператор файла; предыдущие выполняются перед ним в той же транзакции
+type statement struct {
+	path string
+	// текст последнего оператора без EXPLAIN ANALYZE с плейсхолдерами параметров
+	text string
+	args []interface{}
+	// вид и строка последнего оператора в файле
+	kind string
+	line int
+	// оператор возвращает строки: запрос или изменение данных с RETURNING
+	rows bool
+	// операторы перед последним, например SET
+	setup []sqlscript.Statement
+	// запрос может изменять данные; иначе выполняется только для чтения
+	writes bool
+	// имя файлов результата: имя файла запроса и параметры, отличные от значений по умолчанию
+	output  string
+	formats []string
+}
+
+// returnsRows сообщает, что оператор возвращает строки результата
+func (s *statement) returnsRows() bool {
+	return s.rows
+}
+
+// explainable сообщает, что у оператора можно снять план
+func (s *statement) explainable() bool {
+	return s.kind == sqlscript.KindQuery || s.kind == sqlscript.KindDML
+}
+
+// читает файл запроса и привязывает значения его параметров
+func (q *QueryRunner) prepare(query *Query) (*statement, error) {
+	queryBytes, err := os.ReadFile(query.Path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл запроса: %w", err)
 	}
 
-	outputFilePath := filepath.Join(outputDir, fmt.Sprintf("%s.json", queryName))
-	outputFile, err := os.Create(outputFilePath)
+	statements, err := sqlscript.Split(string(queryBytes))
 	if err != nil {
-		return fmt.Errorf("не удалось создать файл результата: %w", err)
+		return nil, fmt.Errorf("%s: %w", query.Path, err)
 	}
-	defer outputFile.Close()
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("в файле %s нет операторов", query.Path)
+	}
+
+	// EXPLAIN ANALYZE в файле снимается: план запрашивает сам исполнитель
+	var binding binding
+	for n := range statements {
+		statements[n] = statements[n].Unexplain()
+		if err := checkWrites(query, statements[n]); err != nil {
+			return nil, err
+		}
+		statements[n].Text, binding, err = bind(query, statements[n].Text, q.params)
+		if err != nil {
+			return nil, err
+		}
+		statements[n].Args = binding.args
+	}
+	last := statements[len(statements)-1]
 
-	encoder := json.NewEncoder(outputFile)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(results); err != nil {
-		return fmt.Errorf("ошибка сериализации результатов: %w", err)
+	formats := q.formats
+	if len(formats) == 0 {
+		formats = query.Formats
+	}
+	if len(formats) == 0 {
+		formats = []string{defaultFormat}
 	}
 
-	q.logger.Info("запрос выполнен успешно",
-		zap.String("file", queryFilePath),
-		zap.Int("row_count", len(results)),
-		zap.String("output", outputFilePath))
+	return &statement{
+		path:    query.Path,
+		text:    last.Text,
+		args:    last.Args,
+		kind:    last.Kind,
+		line:    last.Line,
+		rows:    last.ReturnsRows(),
+		setup:   statements[:len(statements)-1],
+		writes:  query.AllowWrites,
+		output:  filepath.Base(query.Path) + binding.suffix,
+		formats: formats,
+	}, nil
+}
 
+// транзакцию открывает исполнитель; изменять данные могут только запросы
+// с заголовком writes: true
+func checkWrites(query *Query, stmt sqlscript.Statement) error {
+	switch stmt.Kind {
+	case sqlscript.KindTransaction:
+		return fmt.Errorf("%s: строка %d: управление транзакциями в файле запроса не поддерживается", query.Path, stmt.Line)
+	case sqlscript.KindDML, sqlscript.KindDDL:
+		if !query.AllowWrites {
+			return fmt.Errorf("%s: строка %d: оператор вида %s изменяет данные; разрешите запись заголовком \"-- writes: true\"",
+				query.Path, stmt.Line, stmt.Kind)
+		}
+	}
 	return nil
 }
 
-func (q *QueryRunner) ExplainQuery(queryFilePath, outputDir string) error {
-	q.logger.Info("анализ запроса", zap.String("file", queryFilePath))
+func (q *QueryRunner) ExecuteQuery(queryFilePath, outputDir string) error {
+	stmt, err := q.prepare(&Query{Path: queryFilePath})
+	if err != nil {
+		return err
+	}
+	_, err = q.executeQuery(stmt, outputDir)
+	return err
+}
 
-	queryBytes, err := os.ReadFile(queryFilePath)
+// выполняет запрос, записывает результаты и возвращает время выполнения без их записи
+func (q *QueryRunner) executeQuery(stmt *statement, outputDir string) (time.Duration, error) {
+	q.logger.Info("выполнение запроса", zap.String("file", stmt.path))
+
+	ctx := context.Background()
+	conn, err := q.siteConn(ctx)
 	if err != nil {
-		return fmt.Errorf("не удалось прочитать файл запроса: %w", err)
+		return 0, err
 	}
+	defer conn.Close()
 
-	queryText := string(queryBytes)
+	tx, err := q.beginQuery(ctx, conn, stmt)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	if containsTransaction(queryText) {
-		q.logger.Warn("файл содержит транзакции, пропускаем EXPLAIN ANALYZE",
-			zap.String("file", queryFilePath))
-		return nil
+	started := time.Now()
+	if !stmt.returnsRows() {
+		if _, err := tx.ExecContext(ctx, stmt.text, stmt.args...); err != nil {
+			return 0, fmt.Errorf("%s: строка %d: ошибка выполнения оператора: %w", stmt.path, stmt.line, err)
+		}
+		elapsed := time.Since(started)
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+		}
+		q.logger.Info("оператор выполнен, результата нет",
+			zap.String("file", stmt.path),
+			zap.String("kind", stmt.kind),
+			zap.Duration("duration", elapsed))
+		return elapsed, nil
 	}
 
-	queryText = stripExplainAnalyze(queryText)
-	explainQuery := "EXPLAIN ANALYZE " + queryText
+	rows, err := tx.QueryContext(ctx, stmt.text, stmt.args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: строка %d: ошибка выполнения запроса: %w", stmt.path, stmt.line, err)
+	}
+	results, err := scanResultSet(stmt.output, rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(started)
 
-	queryName := filepath.Base(queryFilePath)
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
 
-	rows, err := q.db.Query(explainQuery)
+	outputs, err := writeResults(results, outputDir, stmt.formats)
 	if err != nil {
-		q.logger.Warn("ошибка выполнения запроса EXPLAIN, запускаем без EXPLAIN ANALYZE",
-			zap.String("file", queryFilePath),
-			zap.Error(err))
-		return q.ExecuteQuery(queryFilePath, outputDir)
+		return 0, err
 	}
-	defer rows.Close()
 
+	q.logger.Info("запрос выполнен успешно",
+		zap.String("file", stmt.path),
+		zap.Int("row_count", len(results.Rows)),
+		zap.Duration("duration", elapsed),
+		zap.Strings("output", outputs))
+
+	return elapsed, nil
+}
+
+// записывает результат в файлы <имя>.<расширение> каждого формата
+func writeResults(results *ResultSet, outputDir string, formats []string) ([]string, error) {
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("не удалось создать директорию для результатов: %w", err)
+		return nil, fmt.Errorf("не удалось создать директорию для результатов: %w", err)
+	}
+
+	var outputs []string
+	for _, format := range formats {
+		writer, err := resultWriter(format)
+		if err != nil {
+			return nil, err
+		}
+
+		outputFilePath := filepath.Join(outputDir, results.Name+"."+writer.Extension())
+		outputFile, err := os.Create(outputFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось создать файл результата: %w", err)
+		}
+		if err := writer.Write(outputFile, results); err != nil {
+			outputFile.Close()
+			return nil, fmt.Errorf("ошибка записи результатов в формате %s: %w", format, err)
+		}
+		if err := outputFile.Close(); err != nil {
+			return nil, fmt.Errorf("ошибка записи файла результата: %w", err)
+		}
+		outputs = append(outputs, outputFilePath)
 	}
+	return outputs, nil
+}
 
-	outputFilePath := filepath.Join(outputDir, fmt.Sprintf("%s.explain.txt", queryName))
-	outputFile, err := os.Create(outputFilePath)
+func (q *QueryRunner) ExplainQuery(queryFilePath, outputDir string) error {
+	stmt, err := q.prepare(&Query{Path: queryFilePath})
 	if err != nil {
-		return fmt.Errorf("не удалось создать файл плана запроса: %w", err)
+		return err
 	}
-	defer outputFile.Close()
+	_, _, err = q.explainQuery(stmt, outputDir)
+	return err
+}
 
-	var planLines []string
-	for rows.Next() {
-		var planLine string
-		if err := rows.Scan(&planLine); err != nil {
-			return fmt.Errorf("ошибка сканирования результата: %w", err)
+// сохраняет план запроса и выполняет его; возвращает план (только Postgres)
+// и время выполнения запроса. Запрос на чтение в Postgres выполняется один раз:
+// план выполнения присылает auto_explain. Изменение данных выполняется дважды:
+// план снимается в откатываемой транзакции, чтобы EXPLAIN ANALYZE не изменил
+// данные, а затем оператор выполняется по-настоящему
+func (q *QueryRunner) explainQuery(stmt *statement, outputDir string) (*explain.Plan, time.Duration, error) {
+	q.logger.Info("анализ запроса", zap.String("file", stmt.path))
+
+	if !stmt.explainable() {
+		q.logger.Info("EXPLAIN неприменим к оператору, выполняем без плана",
+			zap.String("file", stmt.path),
+			zap.String("kind", stmt.kind),
+			zap.Int("line", stmt.line))
+		elapsed, err := q.executeQuery(stmt, outputDir)
+		return nil, elapsed, err
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, 0, fmt.Errorf("не удалось создать директорию для результатов: %w", err)
+	}
+
+	if q.store.Driver() == database.DriverSQLite {
+		// EXPLAIN QUERY PLAN не выполняет оператор, результат даёт единственное выполнение
+		if err := q.explainSQLite(stmt, outputDir); err != nil {
+			q.logger.Warn("ошибка выполнения запроса EXPLAIN, запускаем без плана",
+				zap.String("file", stmt.path),
+				zap.Error(err))
 		}
+		elapsed, err := q.executeQuery(stmt, outputDir)
+		return nil, elapsed, err
+	}
 
-		planLines = append(planLines, planLine)
-		fmt.Fprintln(outputFile, planLine)
+	if stmt.kind == sqlscript.KindQuery && !q.noAutoExplain {
+		plan, elapsed, err := q.fetchWithPlan(stmt, outputDir)
+		if !errors.Is(err, errNoAutoExplain) {
+			return plan, elapsed, err
+		}
+		// без auto_explain план можно получить только отдельным выполнением
+		q.noAutoExplain = true
+		q.logger.Warn("auto_explain недоступен, запросы будут выполняться дважды: под EXPLAIN ANALYZE и для получения строк",
+			zap.Error(err))
+	}
+
+	plan, err := q.explainPostgres(stmt, outputDir)
+	if err != nil {
+		q.logger.Warn("ошибка выполнения запроса EXPLAIN, запускаем без EXPLAIN ANALYZE",
+			zap.String("file", stmt.path),
+			zap.Error(err))
+		elapsed, err := q.executeQuery(stmt, outputDir)
+		return nil, elapsed, err
 	}
 
 	q.logger.Info("анализ запроса выполнен успешно",
-		zap.String("file", queryFilePath),
-		zap.String("output", outputFilePath))
-	return q.ExecuteQuery(queryFilePath, outputDir)
+		zap.String("file", stmt.path),
+		zap.String("output", filepath.Join(outputDir, stmt.output+".explain.txt")))
+
+	elapsed, err := q.executeQuery(stmt, outputDir)
+	return plan, elapsed, err
 }
 
-func containsTransaction(query string) bool {
-	queryLower := strings.ToLower(query)
-	return strings.Contains(queryLower, "begin") ||
-		strings.Contains(queryLower, "commit") ||
-		strings.Contains(queryLower, "create ") ||
-		strings.Contains(queryLower, "alter ")
+// errNoAutoExplain означает, что план нельзя получить из выполнения запроса
+var errNoAutoExplain = errors.New("auto_explain недоступен")
+
+// настройки auto_explain на время транзакции запроса: план с фактическим
+// временем и буферами отправляется клиенту уведомлением, а не в журнал сервера
+var autoExplainSettings = []string{
+	"SET LOCAL auto_explain.log_min_duration = 0",
+	"SET LOCAL auto_explain.log_analyze = on",
+	"SET LOCAL auto_explain.log_buffers = on",
+	"SET LOCAL auto_explain.log_format = json",
+	"SET LOCAL auto_explain.log_nested_statements = off",
+	"SET LOCAL auto_explain.log_level = notice",
+	"SET LOCAL client_min_messages = notice",
 }
 
-func stripExplainAnalyze(query string) string {
-	queryLower := strings.ToLower(query)
-	if strings.Contains(queryLower, "explain analyze") {
-		explainPos := strings.Index(queryLower, "explain analyze")
-		startPos := explainPos + len("explain analyze")
-		for startPos < len(query) && (query[startPos] == ' ' || query[startPos] == '\n' || query[startPos] == '\r' || query[startPos] == '\t') {
-			startPos++
+// выполняет запрос один раз: строки читаются как обычно, а план того же
+// выполнения присылает auto_explain. Модуль загружается командой LOAD; без
+// прав суперпользователя она работает, только если модуль установлен в
+// $libdir/plugins. Если модуль загрузить или настроить нельзя, возвращается
+// errNoAutoExplain и запрос ещё не выполнялся
+func (q *QueryRunner) fetchWithPlan(stmt *statement, outputDir string) (*explain.Plan, time.Duration, error) {
+	ctx := context.Background()
+	conn, err := q.siteConn(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "LOAD 'auto_explain'"); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errNoAutoExplain, err)
+	}
+
+	var notices []string
+	setNoticeHandler(conn, func(notice *pq.Error) {
+		notices = append(notices, notice.Message)
+	})
+	// соединение вернётся в пул
+	defer setNoticeHandler(conn, nil)
+
+	tx, err := q.beginQuery(ctx, conn, stmt)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	for _, setting := range autoExplainSettings {
+		if _, err := tx.ExecContext(ctx, setting); err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", errNoAutoExplain, err)
+		}
+	}
+
+	started := time.Now()
+	rows, err := tx.QueryContext(ctx, stmt.text, stmt.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: строка %d: ошибка выполнения запроса: %w", stmt.path, stmt.line, err)
+	}
+	results, err := scanResultSet(stmt.output, rows)
+	rows.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	elapsed := time.Since(started)
+
+	// план приходит при завершении выполнения, которое может наступить
+	// только вместе с транзакцией
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+
+	outputs, err := writeResults(results, outputDir, stmt.formats)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var plan *explain.Plan
+	for _, notice := range notices {
+		if !strings.HasPrefix(notice, "duration:") {
+			continue
 		}
-		if startPos < len(query) {
-			return query[startPos:]
+		planJSON, parsed, err := explain.ParseAutoExplain(notice)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := writePlan(stmt, outputDir, planJSON, parsed); err != nil {
+			return nil, 0, err
+		}
+		plan = parsed
+		outputs = append(outputs, filepath.Join(outputDir, stmt.output+".explain.txt"))
+		break
+	}
+	if plan == nil {
+		q.logger.Warn("auto_explain не прислал план запроса", zap.String("file", stmt.path))
+	}
+
+	q.logger.Info("запрос выполнен с EXPLAIN ANALYZE",
+		zap.String("file", stmt.path),
+		zap.Int("row_count", len(results.Rows)),
+		zap.Duration("duration", elapsed),
+		zap.Strings("output", outputs))
+
+	return plan, elapsed, nil
+}
+
+// устанавливает обработчик уведомлений сервера на соединение lib/pq
+func setNoticeHandler(conn *sqlx.Conn, handler func(*pq.Error)) {
+	conn.Raw(func(driverConn interface{}) error {
+		pq.SetNoticeHandler(driverConn.(driver.Conn), handler)
+		return nil
+	})
+}
+
+// снимает план Postgres в транзакции, которая всегда откатывается: EXPLAIN ANALYZE
+// выполняет оператор, и изменения данных не должны сохраниться
+func (q *QueryRunner) explainPostgres(stmt *statement, outputDir string) (*explain.Plan, error) {
+	ctx := context.Background()
+	conn, err := q.siteConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tx, err := q.beginQuery(ctx, conn, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var planJSON []byte
+	if err := tx.QueryRowContext(ctx, explain.Prefix+stmt.text, stmt.args...).Scan(&planJSON); err != nil {
+		return nil, err
+	}
+	if err := tx.Rollback(); err != nil {
+		return nil, fmt.Errorf("ошибка отката транзакции: %w", err)
+	}
+
+	plan, err := explain.Parse(planJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePlan(stmt, outputDir, planJSON, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// план Postgres сохраняется как есть в <имя>.explain.json и деревом в <имя>.explain.txt
+func writePlan(stmt *statement, outputDir string, planJSON []byte, plan *explain.Plan) error {
+	jsonPath := filepath.Join(outputDir, stmt.output+".explain.json")
+	if err := os.WriteFile(jsonPath, planJSON, 0644); err != nil {
+		return fmt.Errorf("не удалось записать план запроса: %w", err)
+	}
+
+	outputFile, err := os.Create(filepath.Join(outputDir, stmt.output+".explain.txt"))
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл плана запроса: %w", err)
+	}
+	defer outputFile.Close()
+
+	if err := plan.Format(outputFile); err != nil {
+		return fmt.Errorf("ошибка записи плана запроса: %w", err)
+	}
+	return nil
+}
+
+// EXPLAIN QUERY PLAN в SQLite не выполняет запрос: в <имя>.explain.txt
+// записываются строки detail плана
+func (q *QueryRunner) explainSQLite(stmt *statement, outputDir string) error {
+	ctx := context.Background()
+	conn, err := q.siteConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tx, err := q.beginQuery(ctx, conn, stmt)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "EXPLAIN QUERY PLAN "+stmt.text, stmt.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	outputFile, err := os.Create(filepath.Join(outputDir, stmt.output+".explain.txt"))
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл плана запроса: %w", err)
+	}
+	defer outputFile.Close()
+
+	for rows.Next() {
+		// колонки id, parent, notused и detail
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return fmt.Errorf("ошибка сканирования результата: %w", err)
 		}
-		return ""
+		fmt.Fprintln(outputFile, detail)
 	}
-	return query
+	return rows.Err()
 }
 
-// выполняет только аналитические запросы (без скриптов создания/изменения схемы)
+// выполняет все аналитические запросы каталога; скрипты схемы без заголовка
+// метаданных в каталог не попадают
 func (q *QueryRunner) RunAnalyticalQueries(queryDir, outputDir string) error {
-	q.logger.Info("выполнение аналитических запросов", zap.String("dir", queryDir))
-	analyticalQueries := []string{
-		filepath.Join(queryDir, "q1.sql"),
-		filepath.Join(queryDir, "q2.sql"),
+	catalog, err := LoadCatalog(queryDir)
+	if err != nil {
+		return err
+	}
+	return q.RunCatalogQueries(catalog.Queries(), outputDir)
+}
+
+// RunCatalogQueries выполняет запросы каталога с сохранением планов; запросы
+// без нужных объектов базы пропускаются, ошибки отдельных запросов не прерывают остальные
+func (q *QueryRunner) RunCatalogQueries(queries []*Query, outputDir string) error {
+	q.logger.Info("выполнение аналитических запросов",
+		zap.Int("queries", len(queries)),
+		zap.String("site", q.site),
+		zap.String("as_of", q.asOf))
+
+	if q.params != nil {
+		if err := q.params.Check(queries); err != nil {
+			return err
+		}
 	}
 
-	for _, queryPath := range analyticalQueries {
-		if _, err := os.Stat(queryPath); os.IsNotExist(err) {
-			q.logger.Warn("файл запроса не найден, пропускаем",
-				zap.String("file", queryPath))
+	var regressed []string
+	ctx := context.Background()
+	for _, query := range queries {
+		query = query.For(q.store.Driver())
+
+		missing, err := q.MissingObjects(ctx, query)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			q.logger.Warn("в базе нет объектов, нужных запросу, пропускаем",
+				zap.String("query", query.Name),
+				zap.Strings("missing", missing))
 			continue
 		}
 
-		q.logger.Info("обработка запроса", zap.String("file", queryPath))
-		if err := q.ExplainQuery(queryPath, outputDir); err != nil {
+		q.logger.Info("обработка запроса", zap.String("query", query.Name), zap.String("file", query.Path))
+		stmt, err := q.prepare(query)
+		if err != nil {
+			q.logger.Error("ошибка подготовки запроса",
+				zap.String("query", query.Name),
+				zap.Error(err))
+			continue
+		}
+		plan, elapsed, err := q.explainQuery(stmt, outputDir)
+		if err != nil {
 			q.logger.Error("ошибка при анализе запроса",
-				zap.String("file", queryPath),
+				zap.String("query", query.Name),
 				zap.Error(err))
+			continue
+		}
+		if plan != nil {
+			found, err := q.checkPlan(stmt, plan)
+			if err != nil {
+				return err
+			}
+			if len(found) > 0 {
+				regressed = append(regressed, query.Name)
+			}
+		}
+		if query.ExpectedRuntime > 0 && elapsed > query.ExpectedRuntime {
+			q.logger.Warn("запрос выполнялся дольше ожидаемого",
+				zap.String("query", query.Name),
+				zap.Duration("duration", elapsed),
+				zap.Duration("expected", query.ExpectedRuntime))
 		}
 	}
 
+	if len(regressed) > 0 {
+		return fmt.Errorf("регрессии планов запросов: %s", strings.Join(regressed, ", "))
+	}
+
 	q.logger.Info("все аналитические запросы выполнены")
 	return nil
 }
 
-// выполняет запросы из директории
-func (q *QueryRunner) RunAllQueries(queryDir, outputDir string) error {
-	q.logger.Info("выполнение всех запросов", zap.String("dir", queryDir))
-	postTagsScript := filepath.Join(queryDir, "create_post_tags.sql")
-	if _, err := os.Stat(postTagsScript); os.IsNotExist(err) {
-		postTagsSQL := `
-CREATE OR REPLACE FUNCTION extract_tags(tags_text TEXT)
-RETURNS TABLE(tag TEXT) AS $$
-BEGIN
-    IF tags_text IS NULL THEN
-        RETURN;
-    END IF;
-
-    RETURN QUERY
-    SELECT
-        unnest(
-                string_to_array(
-                        regexp_replace(
-                                regexp_replace(tags_text, '[<>]', ' ', 'g'),
-                                '\s+', ' ', 'g'
-                        ),
-                        ' '
-                )
-        ) AS tag
-    WHERE length(tag) > 0;  -- Используем правильный алиас tag вместо unnest
-END;
-$$ LANGUAGE plpgsql;
-
--- Удаляем представление, если оно существует
-DROP MATERIALIZED VIEW IF EXISTS post_tags;
-
--- Создаем представление с разобранными тегами для каждого поста
-CREATE MATERIALIZED VIEW post_tags AS
-SELECT
-    p.id AS post_id,
-    t.tag
-FROM
-    posts p,
-    LATERAL extract_tags(p.tags) t
-WHERE
-    p.tags IS NOT NULL;
-
--- Индекс на представление для быстрого поиска постов по тегу
-CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag);
-CREATE INDEX IF NOT EXISTS idx_post_tags_post_id ON post_tags(post_id);`
-
-		q.logger.Info("создание файла create_post_tags.sql")
-		if err := os.WriteFile(postTagsScript, []byte(postTagsSQL), 0644); err != nil {
-			q.logger.Warn("не удалось создать файл create_post_tags.sql", zap.Error(err))
-		}
-	}
-
-	q.logger.Info("создание/обновление материализованного представления post_tags")
-	if content, err := os.ReadFile(postTagsScript); err == nil {
-		_, err := q.db.Exec(string(content))
+// MissingObjects возвращает объекты из requires запроса, которых нет в базе
+func (q *QueryRunner) MissingObjects(ctx context.Context, query *Query) ([]string, error) {
+	var missing []string
+	for _, name := range query.Requires {
+		exists, err := q.store.HasObject(ctx, name)
 		if err != nil {
-			q.logger.Error("ошибка при создании post_tags", zap.Error(err))
-		} else {
-			q.logger.Info("материализованное представление post_tags успешно создано")
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, name)
 		}
 	}
+	return missing, nil
+}
 
+// выполняет запросы из директории; post_tags и остальные объекты схемы
+// создаются миграциями и обновляются при импорте
+func (q *QueryRunner) RunAllQueries(queryDir, outputDir string) error {
+	q.logger.Info("выполнение всех запросов", zap.String("dir", queryDir))
+
+	// SQLite не умеет добавлять внешние ключи к существующим таблицам
 	constraintsScript := filepath.Join(queryDir, "add_constraints.sql")
-	if _, err := os.Stat(constraintsScript); err == nil {
+	if _, err := os.Stat(constraintsScript); err == nil && q.store.Driver() == database.DriverPostgres {
 		q.logger.Info("добавление ограничений внешнего ключа")
 		if content, err := os.ReadFile(constraintsScript); err == nil {
-			_, err := q.db.Exec(string(content))
-			if err != nil {
+			// BEGIN и COMMIT скрипта должны выполниться в одном соединении
+			if err := q.execScript(constraintsScript, string(content)); err != nil {
 				q.logger.Error("ошибка при добавлении ограничений", zap.Error(err))
 			} else {
 				q.logger.Info("ограничения успешно добавлены")
@@ -268,3 +752,18 @@ CREATE INDEX IF NOT EXISTS idx_post_tags_post_id ON post_tags(post_id);`
 
 	return q.RunAnalyticalQueries(queryDir, outputDir)
 }
+
+// выполняет скрипт по одному оператору в отдельном соединении
+func (q *QueryRunner) execScript(path, script string) error {
+	ctx := context.Background()
+	conn, err := q.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка получения соединения: %w", err)
+	}
+	defer conn.Close()
+
+	if err := sqlscript.Exec(ctx, conn, script); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package queries
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// форматы файлов результатов запросов
+const (
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+const defaultFormat = FormatJSON
+
+// колонка результата: имя и тип базы данных (NUMERIC, TIMESTAMP, ...)
+type Column struct {
+	Name string
+	Type string
+}
+
+// результат запроса с сохранённым порядком колонок. Значения приведены
+// к типам Go: int64, float64, bool, string, time.Time, json.Number для
+// NUMERIC или nil
+type ResultSet struct {
+	Name    string
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// ResultWriter записывает результат запроса в одном формате
+type ResultWriter interface {
+	Extension() string
+	Write(w io.Writer, rs *ResultSet) error
+}
+
+var resultWriters = map[string]ResultWriter{
+	FormatJSON:     jsonWriter{},
+	FormatNDJSON:   ndjsonWriter{},
+	FormatCSV:      csvWriter{},
+	FormatMarkdown: markdownWriter{},
+	FormatHTML:     htmlWriter{},
+}
+
+func resultWriter(format string) (ResultWriter, error) {
+	writer, ok := resultWriters[format]
+	if !ok {
+		formats := make([]string, 0, len(resultWriters))
+		for name := range resultWriters {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+		return nil, fmt.Errorf("неизвестный формат результатов %q, используйте: %s", format, strings.Join(formats, ", "))
+	}
+	return writer, nil
+}
+
+// CheckFormats проверяет, что для всех форматов есть запись результатов
+func CheckFormats(formats []string) error {
+	for _, format := range formats {
+		if _, err := resultWriter(format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// читает все строки результата, приводя значения по типам колонок
+func scanResultSet(name string, rows *sql.Rows) (*ResultSet, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения колонок результата: %w", err)
+	}
+
+	rs := &ResultSet{Name: name, Columns: make([]Column, len(types))}
+	for n, columnType := range types {
+		rs.Columns[n] = Column{
+			Name: columnType.Name(),
+			Type: strings.ToUpper(columnType.DatabaseTypeName()),
+		}
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(rs.Columns))
+		pointers := make([]interface{}, len(values))
+		for n := range values {
+			pointers[n] = &values[n]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования результатов: %w", err)
+		}
+		for n, value := range values {
+			values[n] = normalizeValue(value, rs.Columns[n].Type)
+		}
+		rs.Rows = append(rs.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов запроса: %w", err)
+	}
+	return rs, nil
+}
+
+// драйвер Postgres возвращает NUMERIC строкой байтов; такие значения
+// сохраняются числом без потери точности
+func normalizeValue(value interface{}, columnType string) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		text := string(v)
+		if columnType == "NUMERIC" || columnType == "DECIMAL" {
+			if _, err := strconv.ParseFloat(text, 64); err == nil {
+				return json.Number(text)
+			}
+		}
+		return text
+	case float64:
+		// NaN и бесконечность не представимы в JSON
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	case time.Time:
+		return v.UTC()
+	}
+	return value
+}
+
+// текстовое представление значения для CSV, Markdown и HTML
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// числовая колонка: по типу базы данных, а если его нет (выражения в SQLite) —
+// по значениям
+func (rs *ResultSet) numericColumn(n int) bool {
+	switch rs.Columns[n].Type {
+	case "INT2", "INT4", "INT8", "INTEGER", "BIGINT", "SMALLINT",
+		"FLOAT4", "FLOAT8", "REAL", "DOUBLE PRECISION", "NUMERIC", "DECIMAL":
+		return true
+	case "":
+	default:
+		return false
+	}
+
+	numeric := false
+	for _, row := range rs.Rows {
+		switch row[n].(type) {
+		case nil:
+		case int64, float64, json.Number:
+			numeric = true
+		default:
+			return false
+		}
+	}
+	return numeric
+}
+
+// объект JSON с колонками в порядке результата
+func marshalRow(columns []Column, row []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for n, column := range columns {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row[n])
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сериализации колонки %s: %w", column.Name, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// массив объектов с отступами
+type jsonWriter struct{}
+
+func (jsonWriter) Extension() string { return "json" }
+
+func (jsonWriter) Write(w io.Writer, rs *ResultSet) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for n, row := range rs.Rows {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := marshalRow(rs.Columns, row)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte(']')
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err := indented.WriteTo(w)
+	return err
+}
+
+// один объект JSON на строку
+type ndjsonWriter struct{}
+
+func (ndjsonWriter) Extension() string { return "ndjson" }
+
+func (ndjsonWriter) Write(w io.Writer, rs *ResultSet) error {
+	out := bufio.NewWriter(w)
+	for _, row := range rs.Rows {
+		data, err := marshalRow(rs.Columns, row)
+		if err != nil {
+			return err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+type csvWriter struct{}
+
+func (csvWriter) Extension() string { return "csv" }
+
+func (csvWriter) Write(w io.Writer, rs *ResultSet) error {
+	out := csv.NewWriter(w)
+	record := make([]string, len(rs.Columns))
+	for n, column := range rs.Columns {
+		record[n] = column.Name
+	}
+	if err := out.Write(record); err != nil {
+		return err
+	}
+
+	for _, row := range rs.Rows {
+		for n, value := range row {
+			record[n] = formatValue(value)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// таблица Markdown; числовые колонки выравниваются по правому краю
+type markdownWriter struct{}
+
+func (markdownWriter) Extension() string { return "md" }
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+func (markdownWriter) Write(w io.Writer, rs *ResultSet) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# %s\n\n", rs.Name)
+
+	out.WriteString("|")
+	for _, column := range rs.Columns {
+		fmt.Fprintf(out, " %s |", markdownEscaper.Replace(column.Name))
+	}
+	out.WriteString("\n|")
+	for n := range rs.Columns {
+		if rs.numericColumn(n) {
+			out.WriteString(" ---: |")
+		} else {
+			out.WriteString(" --- |")
+		}
+	}
+	out.WriteString("\n")
+
+	for _, row := range rs.Rows {
+		out.WriteString("|")
+		for _, value := range row {
+			fmt.Fprintf(out, " %s |", markdownEscaper.Replace(formatValue(value)))
+		}
+		out.WriteString("\n")
+	}
+	return out.Flush()
+}
+
+// самостоятельная HTML страница с таблицей результата
+type htmlWriter struct{}
+
+func (htmlWriter) Extension() string { return "html" }
+
+var htmlPage = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; vertical-align: top; }
+th { background: #f0f0f0; text-align: left; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+td.null { color: #999; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Строк: {{len .Rows}}</p>
+<table>
+<thead><tr>{{range .Columns}}<th title="{{.Type}}">{{.Name}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td{{if .Null}} class="null"{{else if .Numeric}} class="num"{{end}}>{{if .Null}}NULL{{else}}{{.Text}}{{end}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+type htmlCell struct {
+	Text    string
+	Numeric bool
+	Null    bool
+}
+
+func (htmlWriter) Write(w io.Writer, rs *ResultSet) error {
+	numeric := make([]bool, len(rs.Columns))
+	for n := range rs.Columns {
+		numeric[n] = rs.numericColumn(n)
+	}
+
+	rows := make([][]htmlCell, len(rs.Rows))
+	for n, row := range rs.Rows {
+		rows[n] = make([]htmlCell, len(row))
+		for k, value := range row {
+			rows[n][k] = htmlCell{
+				Text:    formatValue(value),
+				Numeric: numeric[k],
+				Null:    value == nil,
+			}
+		}
+	}
+
+	return htmlPage.Execute(w, struct {
+		Name    string
+		Columns []Column
+		Rows    [][]htmlCell
+	}{rs.Name, rs.Columns, rows})
+}
@@ -0,0 +1,437 @@
+package sqlscript
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// виды операторов скрипта
+const (
+	KindQuery       = "query"
+	KindDML         = "dml"
+	KindDDL         = "ddl"
+	KindTransaction = "transaction"
+	KindExplain     = "explain"
+	KindOther       = "other"
+)
+
+// оператор скрипта
+type Statement struct {
+	// текст без завершающей точки с запятой и комментариев перед оператором
+	Text string
+	// строка начала оператора в скрипте, с 1
+	Line int
+	Kind string
+	// значения плейсхолдеров $N; заполняет вызывающий код
+	Args []interface{}
+	// слова оператора вне строк, комментариев и тел функций: в нижнем
+	// регистре, с глубиной вложенности скобок и смещением в Text
+	words []word
+}
+
+type word struct {
+	text   string
+	depth  int
+	offset int
+}
+
+// Explainable сообщает, можно ли выполнить оператор под EXPLAIN
+func (s Statement) Explainable() bool {
+	return s.Kind == KindQuery || s.Kind == KindDML
+}
+
+// Unexplain возвращает оператор без префикса EXPLAIN [ANALYZE] [VERBOSE]
+// или EXPLAIN (параметры); остальные операторы возвращаются как есть
+func (s Statement) Unexplain() Statement {
+	if s.Kind != KindExplain {
+		return s
+	}
+
+	n := 1
+	if n < len(s.words) && s.words[n].text == "(" {
+		for n < len(s.words) && !(s.words[n].text == ")" && s.words[n].depth == 0) {
+			n++
+		}
+		n++
+	} else {
+		for n < len(s.words) && (s.words[n].text == "analyze" || s.words[n].text == "analyse" || s.words[n].text == "verbose") {
+			n++
+		}
+	}
+	if n >= len(s.words) {
+		return Statement{Line: s.Line, Kind: KindOther}
+	}
+
+	offset := s.words[n].offset
+	inner := Statement{
+		Text: s.Text[offset:],
+		Line: s.Line + strings.Count(s.Text[:offset], "\n"),
+	}
+	for _, w := range s.words[n:] {
+		w.offset -= offset
+		inner.words = append(inner.words, w)
+	}
+	inner.Kind = classify(inner.words)
+	return inner
+}
+
+// ReturnsRows сообщает, что оператор возвращает строки: запрос, изменение
+// данных с RETURNING или WITH с изменяющими подвыражениями и основным SELECT
+func (s Statement) ReturnsRows() bool {
+	switch s.Kind {
+	case KindQuery:
+		return true
+	case KindDML:
+	default:
+		return false
+	}
+
+	main := s.words[0].text != "with"
+	for _, w := range s.words {
+		if w.depth != 0 {
+			continue
+		}
+		if w.text == "returning" {
+			return true
+		}
+		// основной оператор WITH: первое слово оператора вне подвыражений
+		if kind := statementKinds[w.text]; !main && (kind == KindQuery || kind == KindDML) {
+			if kind == KindQuery {
+				return true
+			}
+			main = true
+		}
+	}
+	return false
+}
+
+func (s Statement) hasWord(text string) bool {
+	for _, w := range s.words {
+		if w.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+// Split разбивает скрипт на операторы по точке с запятой с учётом комментариев,
+// строк, идентификаторов в кавычках, тел функций в $$ и блоков BEGIN ... END
+// триггеров. Пустые операторы и комментарии между операторами пропускаются
+func Split(script string) ([]Statement, error) {
+	var (
+		statements []Statement
+		current    *Statement
+		start      int
+		depth      int
+		// вложенность BEGIN ... END и CASE ... END внутри оператора
+		blocks int
+	)
+	line := 1
+
+	finish := func(end int) {
+		if current != nil {
+			current.Text = strings.TrimRightFunc(script[start:end], unicode.IsSpace)
+			current.Kind = classify(current.words)
+			statements = append(statements, *current)
+		}
+		current, depth, blocks = nil, 0, 0
+	}
+	begin := func(n int) {
+		if current == nil {
+			current = &Statement{Line: line}
+			start = n
+		}
+	}
+	unterminated := func(what string, from int) error {
+		return fmt.Errorf("строка %d: незакрытый %s", from, what)
+	}
+
+	for n := 0; n < len(script); {
+		c := script[n]
+		switch {
+		case c == '\n':
+			line++
+			n++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			n++
+		case strings.HasPrefix(script[n:], "--"):
+			end := strings.IndexByte(script[n:], '\n')
+			if end < 0 {
+				n = len(script)
+			} else {
+				n += end
+			}
+		case strings.HasPrefix(script[n:], "/*"):
+			// комментарии Postgres могут быть вложенными
+			from, nested := line, 0
+			end := n
+			for end < len(script) {
+				if strings.HasPrefix(script[end:], "/*") {
+					nested++
+					end += 2
+				} else if strings.HasPrefix(script[end:], "*/") {
+					nested--
+					end += 2
+					if nested == 0 {
+						break
+					}
+				} else {
+					if script[end] == '\n' {
+						line++
+					}
+					end++
+				}
+			}
+			if nested > 0 {
+				return nil, unterminated("комментарий", from)
+			}
+			n = end
+		case c == '\'' || c == '"':
+			begin(n)
+			// E'...' допускает экранирование обратной косой чертой
+			escapes := c == '\'' && n > 0 && (script[n-1] == 'E' || script[n-1] == 'e') &&
+				(n == 1 || !isWordChar(script[n-2]))
+			from := line
+			end := n + 1
+			for {
+				if end >= len(script) {
+					if c == '"' {
+						return nil, unterminated("идентификатор в кавычках", from)
+					}
+					return nil, unterminated("строковый литерал", from)
+				}
+				ch := script[end]
+				if ch == '\n' {
+					line++
+				}
+				if escapes && ch == '\\' {
+					end += 2
+					continue
+				}
+				if ch == c {
+					if end+1 < len(script) && script[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			n = end + 1
+		case c == '$' && dollarTag(script[n:]) != "":
+			begin(n)
+			tag := dollarTag(script[n:])
+			end := strings.Index(script[n+len(tag):], tag)
+			if end < 0 {
+				return nil, unterminated("блок "+tag, line)
+			}
+			body := script[n : n+len(tag)+end+len(tag)]
+			line += strings.Count(body, "\n")
+			n += len(body)
+		case c == ';':
+			if blocks > 0 {
+				n++
+				continue
+			}
+			finish(n)
+			n++
+		case c == '(' || c == ')':
+			begin(n)
+			if c == ')' && depth > 0 {
+				depth--
+			}
+			current.words = append(current.words, word{text: string(c), depth: depth, offset: n - start})
+			if c == '(' {
+				depth++
+			}
+			n++
+		case isWordChar(c):
+			begin(n)
+			end := n
+			for end < len(script) && (isWordChar(script[end]) || script[end] == '$') {
+				end++
+			}
+			text := strings.ToLower(script[n:end])
+			switch {
+			case text == "begin" && len(current.words) > 0:
+				blocks++
+			case text == "case" && blocks > 0:
+				blocks++
+			case text == "end" && blocks > 0:
+				blocks--
+			}
+			current.words = append(current.words, word{text: text, depth: depth, offset: n - start})
+			n = end
+		default:
+			begin(n)
+			n++
+		}
+	}
+	finish(len(script))
+	return statements, nil
+}
+
+// тег $тег$ в начале строки; позиционные параметры $1 тегом не считаются
+func dollarTag(text string) string {
+	if len(text) < 2 || text[0] != '$' {
+		return ""
+	}
+	if text[1] == '$' {
+		return "$$"
+	}
+	if !(text[1] == '_' || unicode.IsLetter(rune(text[1]))) {
+		return ""
+	}
+	for n := 2; n < len(text); n++ {
+		if text[n] == '$' {
+			return text[:n+1]
+		}
+		if !isWordChar(text[n]) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+var statementKinds = map[string]string{
+	"select": KindQuery,
+	"values": KindQuery,
+	"table":  KindQuery,
+
+	"insert": KindDML,
+	"update": KindDML,
+	"delete": KindDML,
+	"merge":  KindDML,
+
+	"create":   KindDDL,
+	"alter":    KindDDL,
+	"drop":     KindDDL,
+	"truncate": KindDDL,
+	"comment":  KindDDL,
+	"grant":    KindDDL,
+	"revoke":   KindDDL,
+	"reindex":  KindDDL,
+
+	"begin":     KindTransaction,
+	"start":     KindTransaction,
+	"commit":    KindTransaction,
+	"end":       KindTransaction,
+	"rollback":  KindTransaction,
+	"abort":     KindTransaction,
+	"savepoint": KindTransaction,
+	"release":   KindTransaction,
+
+	"explain": KindExplain,
+}
+
+// слова перед UPDATE и DELETE, после которых это не оператор: FOR UPDATE,
+// FOR NO KEY UPDATE, ON CONFLICT DO UPDATE
+var lockClause = map[string]bool{"for": true, "key": true, "do": true}
+
+// вид оператора по первому слову. WITH относится к DML, если основной
+// оператор или одно из подвыражений изменяет данные
+func classify(words []word) string {
+	if len(words) == 0 {
+		return KindOther
+	}
+
+	first := words[0].text
+	if first == "(" {
+		return KindQuery
+	}
+	if first != "with" {
+		if kind, ok := statementKinds[first]; ok {
+			return kind
+		}
+		return KindOther
+	}
+
+	kind := KindQuery
+	for n, w := range words {
+		modifies := w.text == "insert" || w.text == "update" || w.text == "delete" || w.text == "merge"
+		if !modifies {
+			continue
+		}
+		// основной оператор или первое слово подвыражения AS (...)
+		if w.depth == 0 && n > 0 && !lockClause[words[n-1].text] {
+			return KindDML
+		}
+		if n > 0 && words[n-1].text == "(" && n > 1 && (words[n-2].text == "as" || words[n-2].text == "materialized") {
+			kind = KindDML
+		}
+	}
+	return kind
+}
+
+// Execer выполняет оператор: *sql.DB, *sql.Tx, *sql.Conn и их варианты из sqlx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// StatementError — ошибка выполнения оператора скрипта
+type StatementError struct {
+	Line      int
+	Statement string
+	Err       error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("строка %d: %s: %v", e.Line, summary(e.Statement), e.Err)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// первая строка оператора, укороченная для сообщений
+func summary(text string) string {
+	if end := strings.IndexByte(text, '\n'); end >= 0 {
+		text = text[:end]
+	}
+	if len(text) > 60 {
+		text = text[:60] + "..."
+	}
+	return strings.TrimSpace(text)
+}
+
+// Exec выполняет операторы скрипта по одному. Транзакции, открытые скриптом,
+// при ошибке откатываются; db должен быть одним соединением или транзакцией,
+// иначе BEGIN и следующие операторы попадут в разные соединения
+func Exec(ctx context.Context, db Execer, script string) error {
+	statements, err := Split(script)
+	if err != nil {
+		return err
+	}
+	return ExecStatements(ctx, db, statements)
+}
+
+// ExecStatements выполняет уже разобранные операторы по одному
+func ExecStatements(ctx context.Context, db Execer, statements []Statement) error {
+	inTransaction := false
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt.Text, stmt.Args...); err != nil {
+			if inTransaction {
+				db.ExecContext(context.Background(), "ROLLBACK")
+			}
+			return &StatementError{Line: stmt.Line, Statement: stmt.Text, Err: err}
+		}
+
+		if stmt.Kind == KindTransaction {
+			switch stmt.words[0].text {
+			case "begin", "start":
+				inTransaction = true
+			case "commit", "end", "rollback", "abort":
+				// ROLLBACK TO SAVEPOINT транзакцию не завершает
+				inTransaction = inTransaction && stmt.hasWord("to")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package sqlscript
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// оператор в ожидаемом результате: текст, строка и вид
+type split struct {
+	Text string
+	Line int
+	Kind string
+}
+
+func splitOf(statements []Statement) []split {
+	result := make([]split, len(statements))
+	for n, stmt := range statements {
+		result[n] = split{Text: stmt.Text, Line: stmt.Line, Kind: stmt.Kind}
+	}
+	return result
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []split
+	}{
+		{
+			name:   "операторы и пустые операторы",
+			script: "SELECT 1;;\n\nSELECT 2;\n",
+			want: []split{
+				{"SELECT 1", 1, KindQuery},
+				{"SELECT 2", 3, KindQuery},
+			},
+		},
+		{
+			name:   "последний оператор без точки с запятой",
+			script: "SELECT 1;\nSELECT 2",
+			want: []split{
+				{"SELECT 1", 1, KindQuery},
+				{"SELECT 2", 2, KindQuery},
+			},
+		},
+		{
+			name:   "однострочные комментарии",
+			script: "-- заголовок; с точкой с запятой\nSELECT 1; -- хвост;\n-- только комментарий",
+			want: []split{
+				{"SELECT 1", 2, KindQuery},
+			},
+		},
+		{
+			name:   "вложенные многострочные комментарии",
+			script: "/* внешний /* внутренний; */ ещё; */\nSELECT /* ; */ 1;",
+			want: []split{
+				{"SELECT /* ; */ 1", 2, KindQuery},
+			},
+		},
+		{
+			name:   "строки с точкой с запятой и удвоенной кавычкой",
+			script: "SELECT 'a;b', 'it''s;';\nSELECT 2;",
+			want: []split{
+				{"SELECT 'a;b', 'it''s;'", 1, KindQuery},
+				{"SELECT 2", 2, KindQuery},
+			},
+		},
+		{
+			name:   "E-строка с экранированной кавычкой",
+			script: "SELECT E'a\\';b';\nSELECT 2;",
+			want: []split{
+				{"SELECT E'a\\';b'", 1, KindQuery},
+				{"SELECT 2", 2, KindQuery},
+			},
+		},
+		{
+			name:   "обратная косая черта в обычной строке",
+			script: "SELECT 'C:\\';\nSELECT 2;",
+			want: []split{
+				{"SELECT 'C:\\'", 1, KindQuery},
+				{"SELECT 2", 2, KindQuery},
+			},
+		},
+		{
+			name:   "идентификатор в кавычках",
+			script: `SELECT "a;b" FROM "t""x";`,
+			want: []split{
+				{`SELECT "a;b" FROM "t""x"`, 1, KindQuery},
+			},
+		},
+		{
+			name: "тело функции в $$ и $тег$",
+			script: "CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\n" +
+				"CREATE FUNCTION g() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;\nSELECT $1;",
+			want: []split{
+				{"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql", 1, KindDDL},
+				{"CREATE FUNCTION g() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql", 6, KindDDL},
+				{"SELECT $1", 7, KindQuery},
+			},
+		},
+		{
+			name: "блок BEGIN ... END триггера SQLite с CASE",
+			script: "CREATE TRIGGER t AFTER INSERT ON posts BEGIN\n" +
+				"  UPDATE users SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n" +
+				"  DELETE FROM tmp;\n" +
+				"END;\nSELECT 1;",
+			want: []split{
+				{"CREATE TRIGGER t AFTER INSERT ON posts BEGIN\n" +
+					"  UPDATE users SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n" +
+					"  DELETE FROM tmp;\n" +
+					"END", 1, KindDDL},
+				{"SELECT 1", 5, KindQuery},
+			},
+		},
+		{
+			name:   "транзакция",
+			script: "BEGIN;\nINSERT INTO t VALUES (1);\nCOMMIT;",
+			want: []split{
+				{"BEGIN", 1, KindTransaction},
+				{"INSERT INTO t VALUES (1)", 2, KindDML},
+				{"COMMIT", 3, KindTransaction},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := Split(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := splitOf(statements); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("получено:\n%q\nожидается:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitUnterminated(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"SELECT 1;\nSELECT 'abc", "строка 2: незакрытый строковый литерал"},
+		{"SELECT \"abc", "строка 1: незакрытый идентификатор в кавычках"},
+		{"SELECT 1;\n/* /* */", "строка 2: незакрытый комментарий"},
+		{"\n\nCREATE FUNCTION f() AS $x$ SELECT 1", "строка 3: незакрытый блок $x$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			_, err := Split(tt.script)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("ошибка %v, ожидается %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"SELECT 1", KindQuery},
+		{"(SELECT 1) UNION (SELECT 2)", KindQuery},
+		{"VALUES (1), (2)", KindQuery},
+		{"TABLE posts", KindQuery},
+		{"WITH a AS (SELECT 1) SELECT * FROM a", KindQuery},
+		{"SELECT * FROM posts FOR UPDATE", KindQuery},
+		{"SELECT * FROM posts FOR NO KEY UPDATE", KindQuery},
+		{"WITH a AS (SELECT id FROM posts FOR UPDATE) SELECT * FROM a", KindQuery},
+		{"WITH d AS (DELETE FROM posts RETURNING id) SELECT count(*) FROM d", KindDML},
+		{"WITH d AS MATERIALIZED (UPDATE posts SET score = 0 RETURNING id) SELECT * FROM d", KindDML},
+		{"WITH a AS (SELECT 1 AS id) INSERT INTO t SELECT id FROM a", KindDML},
+		{"WITH a AS (SELECT 1 AS id) INSERT INTO t SELECT id FROM a ON CONFLICT (id) DO UPDATE SET id = 1", KindDML},
+		{"INSERT INTO t VALUES (1) ON CONFLICT (id) DO UPDATE SET id = excluded.id", KindDML},
+		{"UPDATE posts SET score = 0", KindDML},
+		{"DELETE FROM posts", KindDML},
+		{"MERGE INTO t USING s ON t.id = s.id WHEN MATCHED THEN DELETE", KindDML},
+		{"CREATE INDEX i ON posts (score)", KindDDL},
+		{"DROP TABLE posts", KindDDL},
+		{"TRUNCATE posts", KindDDL},
+		{"START TRANSACTION", KindTransaction},
+		{"ROLLBACK TO SAVEPOINT s", KindTransaction},
+		{"EXPLAIN ANALYZE SELECT 1", KindExplain},
+		{"SET search_path TO public", KindOther},
+		{"PRAGMA foreign_keys = ON", KindOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			statements, err := Split(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("получено %d операторов, ожидается один", len(statements))
+			}
+			if got := statements[0].Kind; got != tt.want {
+				t.Errorf("вид %s, ожидается %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnexplain(t *testing.T) {
+	tests := []struct {
+		script string
+		text   string
+		line   int
+		kind   string
+	}{
+		{"EXPLAIN ANALYZE SELECT 1", "SELECT 1", 1, KindQuery},
+		{"explain analyse verbose\nSELECT 1", "SELECT 1", 2, KindQuery},
+		{"EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON)\n\nUPDATE t SET a = 1", "UPDATE t SET a = 1", 3, KindDML},
+		{"EXPLAIN WITH a AS (SELECT 1) SELECT * FROM a", "WITH a AS (SELECT 1) SELECT * FROM a", 1, KindQuery},
+		{"SELECT 1", "SELECT 1", 1, KindQuery},
+		{"EXPLAIN ANALYZE", "", 1, KindOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			statements, err := Split(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := statements[0].Unexplain()
+			if got.Text != tt.text || got.Line != tt.line || got.Kind != tt.kind {
+				t.Errorf("получено %q (строка %d, %s), ожидается %q (строка %d, %s)",
+					got.Text, got.Line, got.Kind, tt.text, tt.line, tt.kind)
+			}
+		})
+	}
+}
+
+// execer записывает выполненные операторы и возвращает ошибку на операторе fail
+type execer struct {
+	fail     string
+	executed []string
+}
+
+func (e *execer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.executed = append(e.executed, query)
+	if query == e.fail {
+		return nil, errors.New("ошибка")
+	}
+	return nil, nil
+}
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		fail     string
+		executed []string
+		errLine  int
+	}{
+		{
+			name:     "без ошибок",
+			script:   "CREATE TABLE t (a int);\nINSERT INTO t VALUES (1);",
+			executed: []string{"CREATE TABLE t (a int)", "INSERT INTO t VALUES (1)"},
+		},
+		{
+			name:     "ошибка вне транзакции",
+			script:   "SELECT 1;\nSELECT 2;\nSELECT 3;",
+			fail:     "SELECT 2",
+			executed: []string{"SELECT 1", "SELECT 2"},
+			errLine:  2,
+		},
+		{
+			name:     "ошибка в транзакции скрипта откатывает её",
+			script:   "BEGIN;\nSELECT 1;\nSELECT 2;\nCOMMIT;",
+			fail:     "SELECT 2",
+			executed: []string{"BEGIN", "SELECT 1", "SELECT 2", "ROLLBACK"},
+			errLine:  3,
+		},
+		{
+			name:     "ROLLBACK TO SAVEPOINT не завершает транзакцию",
+			script:   "BEGIN;\nSAVEPOINT s;\nROLLBACK TO SAVEPOINT s;\nSELECT 2;",
+			fail:     "SELECT 2",
+			executed: []string{"BEGIN", "SAVEPOINT s", "ROLLBACK TO SAVEPOINT s", "SELECT 2", "ROLLBACK"},
+			errLine:  4,
+		},
+		{
+			name:     "ошибка после COMMIT без отката",
+			script:   "BEGIN;\nSELECT 1;\nCOMMIT;\nSELECT 2;",
+			fail:     "SELECT 2",
+			executed: []string{"BEGIN", "SELECT 1", "COMMIT", "SELECT 2"},
+			errLine:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &execer{fail: tt.fail}
+			err := Exec(context.Background(), db, tt.script)
+
+			if !reflect.DeepEqual(db.executed, tt.executed) {
+				t.Errorf("выполнено %q, ожидается %q", db.executed, tt.executed)
+			}
+			if tt.errLine == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var stmtErr *StatementError
+			if !errors.As(err, &stmtErr) {
+				t.Fatalf("ошибка %v, ожидается StatementError", err)
+			}
+			if stmtErr.Line != tt.errLine || !strings.HasPrefix(stmtErr.Statement, tt.fail) {
+				t.Errorf("ошибка на строке %d в %q, ожидается строка %d в %q", stmtErr.Line, stmtErr.Statement, tt.errLine, tt.fail)
+			}
+		})
+	}
+}
+
+func TestReturnsRows(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"SELECT 1", true},
+		{"WITH a AS (SELECT 1) SELECT * FROM a", true},
+		{"UPDATE posts SET score = 0", false},
+		{"UPDATE posts SET score = 0 RETURNING id", true},
+		{"DELETE FROM posts WHERE id IN (SELECT id FROM t)", false},
+		{"INSERT INTO t SELECT id FROM posts", false},
+		{"INSERT INTO t VALUES (1) ON CONFLICT (id) DO UPDATE SET id = 1 RETURNING id", true},
+		{"WITH d AS (DELETE FROM posts RETURNING id) SELECT count(*) FROM d", true},
+		{"WITH d AS (DELETE FROM posts RETURNING id) INSERT INTO t SELECT id FROM d", false},
+		{"WITH a AS (SELECT 1 AS id) INSERT INTO t SELECT id FROM a RETURNING id", true},
+		{"CREATE TABLE t AS SELECT 1", false},
+		{"SET search_path TO public", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			statements, err := Split(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := statements[0].ReturnsRows(); got != tt.want {
+				t.Errorf("получено %v, ожидается %v", got, tt.want)
+			}
+		})
+	}
+}
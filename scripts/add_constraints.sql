@@ -1,54 +1,68 @@
 -- Скрипт для добавления ограничений внешнего ключа после импорта данных
+-- (повторный запуск пересоздаёт ограничения, т.к. импорт больше не удаляет таблицы)
 BEGIN;
 
 -- Badges → Users
+ALTER TABLE badges DROP CONSTRAINT IF EXISTS fk_badges_user_id;
 ALTER TABLE badges ADD CONSTRAINT fk_badges_user_id
-    FOREIGN KEY (user_id) REFERENCES users(id);
+    FOREIGN KEY (site, user_id) REFERENCES users(site, id);
 
 -- Posts → Users (owner)
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_owner_user_id;
 ALTER TABLE posts ADD CONSTRAINT fk_posts_owner_user_id
-    FOREIGN KEY (owner_user_id) REFERENCES users(id);
+    FOREIGN KEY (site, owner_user_id) REFERENCES users(site, id);
 
 -- Posts → Users (editor)
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_last_editor_user_id;
 ALTER TABLE posts ADD CONSTRAINT fk_posts_last_editor_user_id
-    FOREIGN KEY (last_editor_user_id) REFERENCES users(id);
+    FOREIGN KEY (site, last_editor_user_id) REFERENCES users(site, id);
 
 -- Posts → Posts (циклические ссылки)
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_accepted_answer_id;
 ALTER TABLE posts ADD CONSTRAINT fk_posts_accepted_answer_id
-    FOREIGN KEY (accepted_answer_id) REFERENCES posts(id);
+    FOREIGN KEY (site, accepted_answer_id) REFERENCES posts(site, id);
 
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_parent_id;
 ALTER TABLE posts ADD CONSTRAINT fk_posts_parent_id
-    FOREIGN KEY (parent_id) REFERENCES posts(id);
+    FOREIGN KEY (site, parent_id) REFERENCES posts(site, id);
 
 -- Comments → Posts
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_post_id;
 ALTER TABLE comments ADD CONSTRAINT fk_comments_post_id
-    FOREIGN KEY (post_id) REFERENCES posts(id);
+    FOREIGN KEY (site, post_id) REFERENCES posts(site, id);
 
 -- Comments → Users
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_user_id;
 ALTER TABLE comments ADD CONSTRAINT fk_comments_user_id
-    FOREIGN KEY (user_id) REFERENCES users(id);
+    FOREIGN KEY (site, user_id) REFERENCES users(site, id);
 
 -- PostHistory → Posts
+ALTER TABLE post_history DROP CONSTRAINT IF EXISTS fk_post_history_post_id;
 ALTER TABLE post_history ADD CONSTRAINT fk_post_history_post_id
-    FOREIGN KEY (post_id) REFERENCES posts(id);
+    FOREIGN KEY (site, post_id) REFERENCES posts(site, id);
 
 -- PostHistory → Users
+ALTER TABLE post_history DROP CONSTRAINT IF EXISTS fk_post_history_user_id;
 ALTER TABLE post_history ADD CONSTRAINT fk_post_history_user_id
-    FOREIGN KEY (user_id) REFERENCES users(id);
+    FOREIGN KEY (site, user_id) REFERENCES users(site, id);
 
 -- PostLinks → Posts
+ALTER TABLE post_links DROP CONSTRAINT IF EXISTS fk_post_links_post_id;
 ALTER TABLE post_links ADD CONSTRAINT fk_post_links_post_id
-    FOREIGN KEY (post_id) REFERENCES posts(id);
+    FOREIGN KEY (site, post_id) REFERENCES posts(site, id);
 
+ALTER TABLE post_links DROP CONSTRAINT IF EXISTS fk_post_links_related_post_id;
 ALTER TABLE post_links ADD CONSTRAINT fk_post_links_related_post_id
-    FOREIGN KEY (related_post_id) REFERENCES posts(id);
+    FOREIGN KEY (site, related_post_id) REFERENCES posts(site, id);
 
 -- Votes → Posts
+ALTER TABLE votes DROP CONSTRAINT IF EXISTS fk_votes_post_id;
 ALTER TABLE votes ADD CONSTRAINT fk_votes_post_id
-    FOREIGN KEY (post_id) REFERENCES posts(id);
+    FOREIGN KEY (site, post_id) REFERENCES posts(site, id);
 
 -- Votes → Users
+ALTER TABLE votes DROP CONSTRAINT IF EXISTS fk_votes_user_id;
 ALTER TABLE votes ADD CONSTRAINT fk_votes_user_id
-    FOREIGN KEY (user_id) REFERENCES users(id);
+    FOREIGN KEY (site, user_id) REFERENCES users(site, id);
 
 COMMIT;
\ No newline at end of file
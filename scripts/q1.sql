@@ -1,10 +1,20 @@
 -- Q1 - "Репутационные пары"
 -- Запрос анализирует какие теги задаются одновременно, как быстро на них отвечают,
 -- и как это связано с репутацией пользователей
+--
+-- name: q1
+-- description: Пары тегов вопросов, скорость ответов и репутация отвечающих
+-- tags: tags, reputation, response-time
+-- runtime: 5s
+-- requires: posts, users, extract_tags
+-- param: min_pairs int = 2 Минимальное число ответов на вопросы с парой тегов
+-- param: tag string = "" Только пары с этим тегом; пустая строка означает все теги
+-- param: limit int = 20 Число пар в результате
 
 EXPLAIN ANALYZE
 WITH question_answer_pairs AS (
     SELECT
+        q.site,
         q.id AS question_id,
         q.creation_date AS question_date,
         a.id AS answer_id,
@@ -15,14 +25,16 @@ WITH question_answer_pairs AS (
     FROM
         posts q
     JOIN
-        posts a ON a.parent_id = q.id
+        posts a ON a.site = q.site AND a.parent_id = q.id
     WHERE
         q.post_type_id = 1
         AND a.post_type_id = 2
         AND q.tags IS NOT NULL
+        AND (current_site() IS NULL OR q.site = current_site())
 ),
 tag_pairs AS (
     SELECT
+        qap.site,
         qap.question_id,
         t1.tag AS tag1,
         t2.tag AS tag2,
@@ -36,8 +48,10 @@ tag_pairs AS (
         extract_tags(qap.question_tags) t2
     WHERE
         t1.tag < t2.tag
+        AND (:tag = '' OR t1.tag = :tag OR t2.tag = :tag)
 )
 SELECT
+    tp.site,
     tp.tag1,
     tp.tag2,
     COUNT(*) AS pair_count,
@@ -48,12 +62,12 @@ SELECT
 FROM
     tag_pairs tp
         JOIN
-    users u ON tp.answerer_id = u.id
+    users u ON u.site = tp.site AND tp.answerer_id = u.id
 GROUP BY
-    tp.tag1, tp.tag2
+    tp.site, tp.tag1, tp.tag2
 HAVING
-    COUNT(*) >= 2
+    COUNT(*) >= :min_pairs
 ORDER BY
     pair_count DESC,
     avg_response_time_minutes ASC
-    LIMIT 20;
\ No newline at end of file
+    LIMIT :limit;
\ No newline at end of file
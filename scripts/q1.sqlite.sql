@@ -0,0 +1,67 @@
+-- Q1 - "Репутационные пары" (диалект SQLite)
+-- Запрос анализирует какие теги задаются одновременно, как быстро на них отвечают,
+-- и как это связано с репутацией пользователей.
+-- В SQLite нет LATERAL и extract_tags, поэтому теги берутся из таблицы post_tags
+--
+-- name: q1
+-- requires: posts, users, post_tags
+
+EXPLAIN ANALYZE
+WITH question_answer_pairs AS (
+    SELECT
+        q.site,
+        q.id AS question_id,
+        q.creation_date AS question_date,
+        a.id AS answer_id,
+        a.creation_date AS answer_date,
+        a.owner_user_id AS answerer_id,
+        (julianday(a.creation_date) - julianday(q.creation_date)) * 1440.0 AS response_time_minutes
+    FROM
+        posts q
+    JOIN
+        posts a ON a.site = q.site AND a.parent_id = q.id
+    WHERE
+        q.post_type_id = 1
+        AND a.post_type_id = 2
+        AND q.tags IS NOT NULL
+        AND (current_site() IS NULL OR q.site = current_site())
+),
+tag_pairs AS (
+    SELECT
+        qap.site,
+        qap.question_id,
+        t1.tag AS tag1,
+        t2.tag AS tag2,
+        qap.response_time_minutes,
+        qap.answerer_id
+    FROM
+        question_answer_pairs qap
+    JOIN
+        post_tags t1 ON t1.site = qap.site AND t1.post_id = qap.question_id
+    JOIN
+        post_tags t2 ON t2.site = qap.site AND t2.post_id = qap.question_id
+    WHERE
+        t1.tag < t2.tag
+        AND (:tag = '' OR t1.tag = :tag OR t2.tag = :tag)
+)
+SELECT
+    tp.site,
+    tp.tag1,
+    tp.tag2,
+    COUNT(*) AS pair_count,
+    AVG(tp.response_time_minutes) AS avg_response_time_minutes,
+    AVG(u.reputation) AS avg_answerer_reputation,
+    STDDEV(tp.response_time_minutes) AS stddev_response_time,
+    CORR(tp.response_time_minutes, u.reputation) AS correlation_time_reputation
+FROM
+    tag_pairs tp
+        JOIN
+    users u ON u.site = tp.site AND tp.answerer_id = u.id
+GROUP BY
+    tp.site, tp.tag1, tp.tag2
+HAVING
+    COUNT(*) >= :min_pairs
+ORDER BY
+    pair_count DESC,
+    avg_response_time_minutes ASC
+    LIMIT :limit;
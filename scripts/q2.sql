@@ -1,8 +1,17 @@
 -- Q2 - "Успешные шутники"
 -- Найти ответы с самыми низкими оценками, которые были приняты как лучший ответ
+--
+-- name: q2
+-- description: Принятые ответы с самыми низкими оценками
+-- tags: answers, score
+-- runtime: 2s
+-- requires: posts, users
+-- param: max_score int = 5 Наибольшая оценка принятого ответа
+-- param: limit int = 20 Число ответов в результате
 
 EXPLAIN ANALYZE
 SELECT
+    q.site,
     a.id AS answer_id,
     q.id AS question_id,
     q.title AS question_title,
@@ -14,15 +23,16 @@ SELECT
 FROM
     posts q
         JOIN
-    posts a ON q.accepted_answer_id = a.id
+    posts a ON a.site = q.site AND q.accepted_answer_id = a.id
         JOIN
-    users u ON a.owner_user_id = u.id
+    users u ON u.site = a.site AND a.owner_user_id = u.id
 WHERE
     q.post_type_id = 1
   AND a.post_type_id = 2
-  AND a.score <= 5
+  AND a.score <= :max_score
   AND q.accepted_answer_id IS NOT NULL
+  AND (current_site() IS NULL OR q.site = current_site())
 ORDER BY
     a.score ASC,
     q.creation_date DESC
-    LIMIT 20;
\ No newline at end of file
+    LIMIT :limit;
\ No newline at end of file